@@ -2,4 +2,7 @@ module github.com/sapcc/concourse-netbox-resource
 
 go 1.25.4
 
-require github.com/netbox-community/go-netbox/v4 v4.2.2-3
+require (
+	github.com/netbox-community/go-netbox/v4 v4.2.2-3
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,17 +1,59 @@
 package app
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
 	"github.com/sapcc/concourse-netbox-resource/internal/helper"
+	"github.com/sapcc/concourse-netbox-resource/internal/netbox"
+	"github.com/sapcc/concourse-netbox-resource/internal/render"
 )
 
+const (
+	onMissingFail      string = "fail"
+	onMissingSkip      string = "skip"
+	onMissingTombstone string = "tombstone"
+)
+
+type tombstone struct {
+	Version    concourse.Version `json:"version"`
+	DetectedAt string            `json:"detected_at"`
+}
+
 var (
-	UsageIn string = `This command implements the Concourse in interface as a noop. It reads the input, validates it, and outputs the version.
+	UsageIn string = `This command implements the Concourse in interface. It reads the input, validates it, and outputs the version
+	together with metadata about the referenced device queried from NetBox.
+	If params.template_content or params.template is set, the inline Go text/template or the template file in the
+	resource container is rendered with the device, its interfaces, IP addresses and config context fetched from NetBox
+	and written to params.template_output in the destination path.
+	If the object of the version no longer exists in NetBox, params.on_missing decides whether the step fails (default),
+	succeeds without output files or writes a tombstone.json file to the destination path.
+	If params.changes is set, the NetBox change records of the object are written to changes.json in the destination path.
+	Objects allocated by out, i.e. allocated_ip, allocated_prefix and allocated_vlan of the version, are written to files
+	of the same name in the destination path.
+	If the version references a script job run by out, its status and log are written to script_job.json and its output
+	to script_output in the destination path.
+
+	{
+	  "params": {
+	    "template_content": "hostname {{ .device.name }}\n",
+	    "template_output": "host.cfg",
+	    "on_missing": "fail|skip|tombstone",
+	    "changes": true,
+	    "changes_since": "24h"
+	  }
+	}
 
 	Example: in /tmp/build/get < request.json
 	`
@@ -24,14 +66,15 @@ func In() {
 		err    error
 	)
 
-	input, err = validateInInput(os.Stdin)
+	outPath := flag.Arg(0)
+	input, err = validateInInput(os.Stdin, outPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("input validation failed: %w", err))
 		os.Exit(1)
 	}
 
-	outPath := os.Args[1]
-	file, err := os.Create(outPath + "/version.json")
+	versionPath := filepath.Join(outPath, "version.json")
+	file, err := os.Create(versionPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to create output file: %w", err))
 		os.Exit(1)
@@ -45,9 +88,71 @@ func In() {
 
 	output.Version = input.Version
 
+	// the version of a setup put does not reference a NetBox object
+	if input.Version.ObjectType == setupObjectType {
+		if err := json.NewEncoder(file).Encode(output); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to write JSON output to %s: %w", versionPath, err))
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(output); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to write JSON to stdout: %w", err))
+		}
+		return
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	exists, err := netbox.ObjectExists(input, ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to verify the existence of the object: %w", err))
+		os.Exit(1)
+	}
+
+	if exists {
+		output.Metadata, err = netbox.Metadata(input, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to query metadata: %w", err))
+		}
+
+		if len(input.Params.Template) > 0 || len(input.Params.TemplateContent) > 0 {
+			err = renderTemplate(input, outPath, ctx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("template rendering failed: %w", err))
+				os.Exit(1)
+			}
+		}
+
+		if input.Params.Changes {
+			err = writeChanges(input, outPath, ctx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("changelog query failed: %w", err))
+				os.Exit(1)
+			}
+		}
+	} else {
+		output.Metadata, err = handleMissingObject(input, outPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	err = writeAllocations(input.Version, outPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to write allocations: %w", err))
+		os.Exit(1)
+	}
+
+	if len(input.Version.ScriptJob) > 0 {
+		err = writeScriptResult(input, outPath, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("script job query failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
 	err = json.NewEncoder(file).Encode(output)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to write JSON output to %s: %w", (outPath+"/version.json"), err))
+		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to write JSON output to %s: %w", versionPath, err))
 	}
 
 	err = json.NewEncoder(os.Stdout).Encode(output)
@@ -56,24 +161,218 @@ func In() {
 	}
 }
 
-func validateInInput(stdin io.Reader) (concourse.Input, error) {
+func validateInInput(stdin io.Reader, path string) (concourse.Input, error) {
 	var (
 		inputParsed concourse.Input
 		err         error
 	)
 
-	if len(os.Args) < 2 {
-		return concourse.Input{}, fmt.Errorf("destination path argument is required")
-	}
-
-	path := os.Args[1]
-	if path != helper.ConcourseOutputPath {
-		return concourse.Input{}, fmt.Errorf("invalid destination path: %s", path)
+	if err = helper.ValidateDirectory(path); err != nil {
+		return concourse.Input{}, fmt.Errorf("invalid destination path: %w", err)
 	}
 
 	err = json.NewDecoder(stdin).Decode(&inputParsed)
 	if err != nil && err != io.EOF {
 		return concourse.Input{}, fmt.Errorf("failed to decode stdin: %w", err)
 	}
+
+	if _, err = getChangesSince(inputParsed); err != nil {
+		return concourse.Input{}, err
+	}
+
+	if err = validateTemplateParams(inputParsed.Params); err != nil {
+		return concourse.Input{}, err
+	}
+
+	switch inputParsed.Params.OnMissing {
+	case "", onMissingFail, onMissingSkip, onMissingTombstone:
+	default:
+		return concourse.Input{}, fmt.Errorf("invalid params.on_missing: %s", inputParsed.Params.OnMissing)
+	}
 	return inputParsed, nil
 }
+
+func handleMissingObject(input concourse.Input, outPath string) ([]concourse.Metadata, error) {
+	var (
+		metadata []concourse.Metadata
+	)
+
+	missing := fmt.Sprintf("%s %s of version %s was not found in NetBox", input.Version.ObjectType, input.Version.Id, input.Version.LastUpdated)
+	switch input.Params.OnMissing {
+	case onMissingSkip:
+		fmt.Fprintln(os.Stderr, missing+", skipping")
+		metadata = append(metadata, concourse.Metadata{Name: "missing", Value: "true"})
+	case onMissingTombstone:
+		tombstonePath := filepath.Join(outPath, "tombstone.json")
+		file, err := os.Create(tombstonePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tombstone file: %w", err)
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("failed to close file after writing tombstone: %w", err))
+			}
+		}()
+
+		err = json.NewEncoder(file).Encode(tombstone{
+			Version:    input.Version,
+			DetectedAt: time.Now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write JSON output to %s: %w", tombstonePath, err)
+		}
+		fmt.Fprintln(os.Stderr, missing+", tombstone written to "+tombstonePath)
+		metadata = append(metadata, concourse.Metadata{Name: "tombstone", Value: "true"})
+	default:
+		return nil, fmt.Errorf("%s", missing)
+	}
+	return metadata, nil
+}
+
+func renderTemplate(input concourse.Input, outPath string, ctx context.Context) error {
+	details, err := netbox.FetchDetails(input, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch details from NetBox: %w", err)
+	}
+
+	data, err := details.TemplateData(input.Version)
+	if err != nil {
+		return err
+	}
+
+	return writeTemplate(input.Params, data, outPath)
+}
+
+// the output file is only written after rendering succeeded, so a broken template leaves no partial file
+func writeTemplate(params concourse.Params, data any, outPath string) error {
+	var (
+		result string
+		err    error
+	)
+
+	if len(params.TemplateContent) > 0 {
+		result, err = render.String("template_content", params.TemplateContent, data)
+	} else {
+		var buffer bytes.Buffer
+		err = render.Template(helper.ResolvePath(outPath, params.Template), data, &buffer)
+		result = buffer.String()
+	}
+	if err != nil {
+		return err
+	}
+
+	resultPath := filepath.Join(outPath, templateOutputName(params))
+	if err := os.WriteFile(resultPath, []byte(result), 0644); err != nil {
+		return fmt.Errorf("failed to write template output file: %w", err)
+	}
+	return nil
+}
+
+// a get step only sees its destination directory, so the template is passed inline or is part of the resource image
+func validateTemplateParams(params concourse.Params) error {
+	if len(params.Template) > 0 && len(params.TemplateContent) > 0 {
+		return fmt.Errorf("params.template and params.template_content are mutually exclusive")
+	}
+	if len(params.TemplateContent) > 0 && len(params.TemplateOutput) == 0 {
+		return fmt.Errorf("params.template_output is required with params.template_content")
+	}
+	if len(params.Template) > 0 || len(params.TemplateContent) > 0 {
+		if name := templateOutputName(params); !filepath.IsLocal(name) {
+			return fmt.Errorf("params.template_output must be a relative path inside the destination directory: %s", name)
+		}
+	}
+	return nil
+}
+
+func writeChanges(input concourse.Input, outPath string, ctx context.Context) error {
+	since, err := getChangesSince(input)
+	if err != nil {
+		return err
+	}
+
+	changes, err := netbox.ObjectChanges(input, since, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch changes from NetBox: %w", err)
+	}
+
+	changesPath := filepath.Join(outPath, "changes.json")
+	file, err := os.Create(changesPath)
+	if err != nil {
+		return fmt.Errorf("failed to create changes file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to close file after writing changes: %w", err))
+		}
+	}()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(changes); err != nil {
+		return fmt.Errorf("failed to write JSON output to %s: %w", changesPath, err)
+	}
+	return nil
+}
+
+func getChangesSince(input concourse.Input) (time.Time, error) {
+	if len(input.Params.ChangesSince) == 0 {
+		return time.Time{}, nil
+	}
+
+	if since, err := time.Parse(time.RFC3339, input.Params.ChangesSince); err == nil {
+		return since.UTC(), nil
+	}
+
+	duration, err := time.ParseDuration(input.Params.ChangesSince)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid params.changes_since, expected RFC3339 timestamp or duration: %s", input.Params.ChangesSince)
+	}
+	lastUpdated, err := time.Parse(time.RFC3339, input.Version.LastUpdated)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("params.changes_since duration requires a valid 'version.last_updated': %w", err)
+	}
+	return lastUpdated.UTC().Add(-duration), nil
+}
+
+func writeAllocations(version concourse.Version, outPath string) error {
+	allocations := map[string]string{
+		"allocated_ip":     version.AllocatedIp,
+		"allocated_prefix": version.AllocatedPrefix,
+		"allocated_vlan":   version.AllocatedVlan,
+	}
+	for fileName, value := range allocations {
+		if len(value) == 0 {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(outPath, fileName), []byte(value+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+func writeScriptResult(input concourse.Input, outPath string, ctx context.Context) error {
+	result, err := netbox.FetchScriptResult(input, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch script job from NetBox: %w", err)
+	}
+
+	resultBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode script job: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outPath, "script_job.json"), append(resultBytes, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write script_job.json: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outPath, "script_output"), []byte(result.Output), 0644); err != nil {
+		return fmt.Errorf("failed to write script_output: %w", err)
+	}
+	return nil
+}
+
+func templateOutputName(params concourse.Params) string {
+	if len(params.TemplateOutput) > 0 {
+		return params.TemplateOutput
+	}
+	return strings.TrimSuffix(filepath.Base(params.Template), ".tmpl")
+}
@@ -1,36 +1,230 @@
 package app
 
 import (
-	"flag"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
 	"github.com/sapcc/concourse-netbox-resource/internal/helper"
 )
 
 func TestValidateInInput(t *testing.T) {
 	tests := []struct {
-		name    string
-		stdin   string
-		osArg   string
-		wantErr bool
+		name       string
+		stdin      string
+		outputPath string
+		useTempDir bool
+		wantErr    bool
 	}{
-		{"noInput", "", "", true},
-		{"missingOutputPath", helper.ConcourseVersion, "", true},
-		{"validInput", helper.ConcourseVersion, helper.ConcourseOutputPath, false},
+		{"noInput", "", "", false, true},
+		{"missingOutputPath", helper.ConcourseVersion, "", false, true},
+		{"notExistingOutputPath", helper.ConcourseVersion, "/not/existing/path", false, true},
+		{"invalidOnMissing", helper.ConcourseVersionInvalidOnMissing, "", true, true},
+		{"validInput", helper.ConcourseVersion, "", true, false},
+		{"validInputNestedPath", helper.ConcourseVersion, "builds/42/get", true, false},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			os.Args[1] = test.osArg
-			flag.Parse()
+			outputPath := test.outputPath
+			if test.useTempDir {
+				outputPath = filepath.Join(t.TempDir(), test.outputPath)
+				if err := helper.EnsureFolder(outputPath); err != nil {
+					t.Fatalf("error creating folder %s: %v", outputPath, err)
+				}
+			}
 
 			stdinReader := strings.NewReader(test.stdin)
-			_, err := validateInInput(stdinReader)
+			_, err := validateInInput(stdinReader, outputPath)
 			if (err != nil) != test.wantErr {
 				t.Errorf("validateInput() error: '%v', error expected: %v", err, test.wantErr)
 			}
 		})
 	}
 }
+
+func TestTemplateOutputName(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   concourse.Params
+		expected string
+	}{
+		{"stripTmplSuffix", concourse.Params{Template: "repo/templates/host.cfg.tmpl"}, "host.cfg"},
+		{"keepOtherSuffix", concourse.Params{Template: "repo/templates/host.cfg"}, "host.cfg"},
+		{"explicitOutput", concourse.Params{Template: "repo/templates/host.cfg.tmpl", TemplateOutput: "rendered.cfg"}, "rendered.cfg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := templateOutputName(test.params); result != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateTemplateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  concourse.Params
+		wantErr bool
+	}{
+		{"none", concourse.Params{}, false},
+		{"templateFile", concourse.Params{Template: "/templates/host.cfg.tmpl"}, false},
+		{"templateContent", concourse.Params{TemplateContent: "{{ .device.name }}", TemplateOutput: "host.cfg"}, false},
+		{"contentWithoutOutput", concourse.Params{TemplateContent: "{{ .device.name }}"}, true},
+		{"fileAndContent", concourse.Params{Template: "/templates/host.cfg.tmpl", TemplateContent: "{{ .device.name }}", TemplateOutput: "host.cfg"}, true},
+		{"outputEscapes", concourse.Params{TemplateContent: "{{ .device.name }}", TemplateOutput: "../host.cfg"}, true},
+		{"absoluteOutput", concourse.Params{Template: "/templates/host.cfg.tmpl", TemplateOutput: "/etc/host.cfg"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateTemplateParams(test.params); (err != nil) != test.wantErr {
+				t.Errorf("validateTemplateParams() error: '%v', error expected: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	data := map[string]any{"device": map[string]any{"name": "server-1"}}
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		wantErr  bool
+	}{
+		{"rendered", "hostname {{ .device.name }}", "hostname server-1", false},
+		{"missingKey", "hostname {{ .device.serial }}", "", true},
+		{"invalidSyntax", "hostname {{ .device.name", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outPath := t.TempDir()
+			params := concourse.Params{TemplateContent: test.content, TemplateOutput: "host.cfg"}
+			err := writeTemplate(params, data, outPath)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("writeTemplate() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			content, readErr := os.ReadFile(filepath.Join(outPath, "host.cfg"))
+			if test.wantErr {
+				if readErr == nil {
+					t.Errorf("expected no output file after failed rendering, got %q", content)
+				}
+				return
+			}
+			if string(content) != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, content)
+			}
+		})
+	}
+}
+
+func TestHandleMissingObject(t *testing.T) {
+	tests := []struct {
+		name          string
+		onMissing     string
+		wantTombstone bool
+		wantErr       bool
+	}{
+		{"defaultFails", "", false, true},
+		{"fail", "fail", false, true},
+		{"skip", "skip", false, false},
+		{"tombstone", "tombstone", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outPath := t.TempDir()
+			input := concourse.Input{
+				Version: concourse.Version{Id: "123", ObjectType: "devices"},
+				Params:  concourse.Params{OnMissing: test.onMissing},
+			}
+
+			_, err := handleMissingObject(input, outPath)
+			if (err != nil) != test.wantErr {
+				t.Errorf("handleMissingObject() error: '%v', error expected: %v", err, test.wantErr)
+			}
+
+			_, err = os.Stat(filepath.Join(outPath, "tombstone.json"))
+			if (err == nil) != test.wantTombstone {
+				t.Errorf("tombstone.json present: %v, tombstone expected: %v", err == nil, test.wantTombstone)
+			}
+		})
+	}
+}
+
+func TestGetChangesSince(t *testing.T) {
+	tests := []struct {
+		name         string
+		changesSince string
+		expected     string
+		wantErr      bool
+	}{
+		{"empty", "", "0001-01-01T00:00:00Z", false},
+		{"timestamp", "2025-06-20T10:00:00Z", "2025-06-20T10:00:00Z", false},
+		{"duration", "24h", "2025-06-22T15:16:56Z", false},
+		{"invalid", "yesterday", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := concourse.Input{
+				Version: concourse.Version{LastUpdated: "2025-06-23T15:16:56Z"},
+				Params:  concourse.Params{ChangesSince: test.changesSince},
+			}
+
+			since, err := getChangesSince(input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("getChangesSince() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if !test.wantErr && since.Format(time.RFC3339) != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, since.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestWriteAllocations(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  concourse.Version
+		expected map[string]string
+	}{
+		{"noAllocation", concourse.Version{Id: "123"}, map[string]string{}},
+		{"allocatedIp", concourse.Version{Id: "123", AllocatedIp: "10.0.0.5/24"}, map[string]string{"allocated_ip": "10.0.0.5/24\n"}},
+		{"allocatedPrefixAndVlan", concourse.Version{Id: "123", AllocatedPrefix: "10.0.1.0/26", AllocatedVlan: "101"}, map[string]string{"allocated_prefix": "10.0.1.0/26\n", "allocated_vlan": "101\n"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outPath := t.TempDir()
+			if err := writeAllocations(test.version, outPath); err != nil {
+				t.Fatalf("writeAllocations() error: '%v'", err)
+			}
+
+			entries, err := os.ReadDir(outPath)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", outPath, err)
+			}
+			if len(entries) != len(test.expected) {
+				t.Errorf("expected %d files, got %d", len(test.expected), len(entries))
+			}
+			for fileName, expectedContent := range test.expected {
+				content, err := os.ReadFile(filepath.Join(outPath, fileName))
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", fileName, err)
+				}
+				if string(content) != expectedContent {
+					t.Errorf("expected %s content '%s', got '%s'", fileName, expectedContent, string(content))
+				}
+			}
+		})
+	}
+}
@@ -2,17 +2,143 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
 	"github.com/sapcc/concourse-netbox-resource/internal/helper"
+	"github.com/sapcc/concourse-netbox-resource/internal/netbox"
+	"github.com/sapcc/concourse-netbox-resource/internal/render"
+)
+
+const (
+	defaultJournalComment   string = "Updated by Concourse build [{{ .BUILD_PIPELINE_NAME }}/{{ .BUILD_JOB_NAME }} #{{ .BUILD_NAME }}]({{ .BUILD_URL }})"
+	defaultChangelogMessage string = "Updated by Concourse build {{ .BUILD_PIPELINE_NAME }}/{{ .BUILD_JOB_NAME }} #{{ .BUILD_NAME }} {{ .BUILD_URL }}"
+	// the object type of the version returned by puts, which do not update a device or interface
+	setupObjectType string = "setup"
 )
 
 var (
-	UsageOut string = `This command implements the Concourse out interface as a noop. It reads the input, validates it, and outputs the version.
+	UsageOut string = `This command implements the Concourse out interface. It reads the input, validates it, applies the params
+	to the device or interface referenced by the fetched version and outputs the new version together with metadata about the device.
+	The version is read from params.version_file (default: version.json) relative to the source path. Puts with only apply, objects,
+	bulk or register_webhook params do not need a version and output a version with object_type setup.
+	Every write carries params.changelog_message, a Go text/template rendered with the Concourse build metadata, as
+	change log message (NetBox 4.4 and later). An empty message disables it.
+	If params.acquire is set, a device matching source.filter that is not claimed yet is claimed for the build instead,
+	using source.lock. params.release clears the claim of the device referenced by the fetched version, if it is owned
+	by the pipeline of the build or params.force is set.
+
+	{
+	  "params": {
+	    "version_file": "example.netbox/version.json",
+	    "status": "active",
+	    "custom_fields": {
+	      "firmware_version": "1.2.3"
+	    },
+	    "custom_fields_file": "facts/custom_fields.yaml",
+	    "add_tags": ["burn-in-passed"],
+	    "remove_tags": ["needs-reimage"],
+	    "journal": {
+	      "kind": "success",
+	      "comment": "Deployed by {{ .BUILD_PIPELINE_NAME }}/{{ .BUILD_JOB_NAME }} #{{ .BUILD_NAME }}",
+	      "comment_file": "deploy/summary.md"
+	    },
+	    "interface": {
+	      "enabled": true,
+	      "description": "uplink",
+	      "mtu": 9000,
+	      "mode": "tagged",
+	      "untagged_vlan": 10,
+	      "tagged_vlans": [11, 12],
+	      "mac_address": "00:11:22:33:44:55"
+	    },
+	    "interface_file": "switchport/applied.yaml",
+	    "allocate_ip": {
+	      "prefix": "10.0.0.0/24",
+	      "dns_name": "server01.example.local",
+	      "status": "active",
+	      "interface": "eth0",
+	      "primary": true
+	    },
+	    "allocate_prefix": {
+	      "parent_prefix": "10.0.0.0/16",
+	      "prefix_length": 26,
+	      "status": "active"
+	    },
+	    "allocate_vlan": {
+	      "vlan_group": "tenant-vlans",
+	      "name": "tenant-a",
+	      "min_vid": 100,
+	      "max_vid": 199
+	    },
+	    "apply": {
+	      "file": "inventory/netbox.yaml",
+	      "prune": true,
+	      "prune_tag": "managed-by-concourse"
+	    },
+	    "local_context": {
+	      "file": "generated/host_context.yaml",
+	      "mode": "replace|merge|patch",
+	      "virtual_machine": "vm-1"
+	    },
+	    "script": {
+	      "name": "ValidateCabling",
+	      "data": {
+	        "site": "site-a"
+	      },
+	      "data_file": "facts/script_data.yaml",
+	      "commit": true,
+	      "timeout": "10m"
+	    },
+	    "dry_run": true,
+	    "conflict": "merge",
+	    "changelog_message": "Deployed by {{ .BUILD_PIPELINE_NAME }}/{{ .BUILD_JOB_NAME }} #{{ .BUILD_NAME }}",
+	    "acquire": true,
+	    "release": false,
+	    "objects": {
+	      "file": "decommission/objects.yaml",
+	      "max_deletes": 5,
+	      "confirm_tag": "decommission-approved"
+	    },
+	    "bulk": {
+	      "file": "inventory/firmware_updates.yaml",
+	      "updates": [
+	        {
+	          "object_type": "devices",
+	          "id": 123,
+	          "fields": {
+	            "custom_fields": {
+	              "bios_version": "2.19.1"
+	            }
+	          }
+	        }
+	      ],
+	      "chunk_size": 100
+	    },
+	    "lldp": {
+	      "file": "discovery/lldp_neighbors.json",
+	      "create_cables": true,
+	      "mark_status": "planned",
+	      "mark_tag": "lldp-mismatch"
+	    },
+	    "register_webhook": {
+	      "name": "concourse-example-netbox",
+	      "resource": "example.netbox",
+	      "webhook_token": "((netbox_webhook_token))",
+	      "event_types": ["object_created", "object_updated", "object_deleted"]
+	    }
+	  }
+	}
 
 	Example: out /tmp/build/put < source.json
 	`
@@ -20,57 +146,569 @@ var (
 
 func Out() {
 	var (
-		input  concourse.Input
-		output concourse.Output
-		err    error
+		input   concourse.Input
+		fetched concourse.Input
+		output  concourse.Output
+		err     error
 	)
 
-	input, _, err = validateOutInput(os.Stdin)
+	input, fetched, err = validateOutInput(os.Stdin, flag.Arg(0))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("input validation failed: %w", err))
 		os.Exit(1)
 	}
 
-	output.Version = input.Version
+	target := concourse.Input{Source: input.Source, Version: fetched.Version, Params: input.Params}
+
+	message, err := changelogMessage(input.Params)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("changelog message rendering failed: %w", err))
+		os.Exit(1)
+	}
+	netbox.SetChangelogMessage(message)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if input.Params.Acquire {
+		target.Version, err = netbox.Acquire(target, helper.BuildIdentity(helper.BuildMetadata()), ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox device lock failed: %w", err))
+			os.Exit(1)
+		}
+		fetched.Version = target.Version
+	}
+
+	var concurrentChanges []netbox.FieldDiff
+	output.Version = target.Version
+	if versionRequired(input.Params) {
+		concurrentChanges, err = netbox.CheckConflict(target, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox conflict check failed: %w", err))
+			os.Exit(1)
+		}
+
+		output.Version, err = netbox.Update(target, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox update failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	if input.Params.AllocateIp != nil {
+		output.Version, err = netbox.AllocateIp(concourse.Input{Source: input.Source, Version: output.Version, Params: input.Params}, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox IP address allocation failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	if input.Params.AllocatePrefix != nil {
+		output.Version, err = netbox.AllocatePrefix(concourse.Input{Source: input.Source, Version: output.Version, Params: input.Params}, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox prefix allocation failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	if input.Params.AllocateVlan != nil {
+		output.Version, err = netbox.AllocateVlan(concourse.Input{Source: input.Source, Version: output.Version, Params: input.Params}, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox VLAN allocation failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	var plan []netbox.PlannedChange
+	if input.Params.Apply != nil {
+		plan, err = netbox.Apply(input, ctx)
+		if err != nil {
+			printAppliedChanges(plan)
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox apply failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	var objectsPlan []netbox.PlannedChange
+	if input.Params.Objects != nil {
+		objectsPlan, err = netbox.Objects(input, ctx)
+		if err != nil {
+			printAppliedChanges(objectsPlan)
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox object creation and deletion failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	var bulkResult netbox.BulkResult
+	if input.Params.Bulk != nil {
+		bulkResult, err = netbox.BulkUpdate(input, ctx)
+		for _, chunkError := range bulkResult.Errors {
+			fmt.Fprintln(os.Stderr, chunkError)
+		}
+		if err != nil {
+			// the metadata of a failed put is discarded
+			fmt.Fprintln(os.Stderr, bulkResult)
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox bulk update failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	var cableMismatches []netbox.CableMismatch
+	if input.Params.Lldp != nil {
+		cableMismatches, err = netbox.Lldp(concourse.Input{Source: input.Source, Version: output.Version, Params: input.Params}, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox LLDP cable comparison failed: %w", err))
+			os.Exit(1)
+		}
+		for _, mismatch := range cableMismatches {
+			fmt.Fprintln(os.Stderr, mismatch)
+		}
+	}
+
+	var scriptResult netbox.ScriptResult
+	if input.Params.Script != nil {
+		output.Version, scriptResult, err = netbox.RunScript(concourse.Input{Source: input.Source, Version: output.Version, Params: input.Params}, ctx)
+		printScriptLog(scriptResult)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox script failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	if input.Params.Release {
+		output.Version, err = netbox.Release(concourse.Input{Source: input.Source, Version: output.Version, Params: input.Params}, helper.BuildIdentity(helper.BuildMetadata()), ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox device release failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	if input.Params.Journal != nil {
+		comment, err := journalComment(*input.Params.Journal, flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("journal comment rendering failed: %w", err))
+			os.Exit(1)
+		}
+
+		err = netbox.CreateJournalEntry(concourse.Input{Source: input.Source, Version: output.Version, Params: input.Params}, comment, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox journal entry creation failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	var registrations []netbox.Registration
+	if input.Params.RegisterWebhook != nil {
+		payloadUrl := input.Params.RegisterWebhook.Url
+		if len(payloadUrl) == 0 {
+			payloadUrl = helper.WebhookUrl(helper.BuildMetadata(), input.Params.RegisterWebhook.Resource, input.Params.RegisterWebhook.WebhookToken)
+		}
+		registrations, err = netbox.RegisterWebhook(input, payloadUrl, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("netbox webhook registration failed: %w", err))
+			os.Exit(1)
+		}
+	}
+
+	if versionRequired(input.Params) {
+		output.Metadata, err = netbox.Metadata(concourse.Input{Source: input.Source, Version: output.Version}, ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to query metadata: %w", err))
+		}
+	}
+	output.Metadata = append(output.Metadata, allocationMetadata(output.Version)...)
+	if len(output.Version.ScriptJob) > 0 {
+		output.Metadata = append(output.Metadata,
+			concourse.Metadata{Name: "script_job", Value: output.Version.ScriptJob},
+			concourse.Metadata{Name: "script_status", Value: scriptResult.Status},
+		)
+	}
+	if len(concurrentChanges) > 0 {
+		output.Metadata = append(output.Metadata, concurrentChangesMetadata(concurrentChanges))
+	}
+	if input.Params.Apply != nil {
+		output.Metadata = append(output.Metadata, applyMetadata("apply", plan)...)
+	}
+	if input.Params.Objects != nil {
+		output.Metadata = append(output.Metadata, applyMetadata("objects", objectsPlan)...)
+	}
+	if input.Params.Lldp != nil {
+		output.Metadata = append(output.Metadata, lldpMetadata(cableMismatches)...)
+	}
+	if len(registrations) > 0 {
+		lines := make([]string, 0, len(registrations))
+		for _, registration := range registrations {
+			lines = append(lines, registration.String())
+		}
+		output.Metadata = append(output.Metadata, concourse.Metadata{Name: "webhook_registration", Value: strings.Join(lines, "\n")})
+	}
+	if input.Params.Bulk != nil {
+		output.Metadata = append(output.Metadata, concourse.Metadata{Name: "bulk_result", Value: bulkResult.String()})
+	}
+	if input.Params.Acquire {
+		output.Metadata = append(output.Metadata, concourse.Metadata{Name: "lock_owner", Value: helper.BuildIdentity(helper.BuildMetadata())})
+	}
+
+	// a dry run only reports the requests and keeps the fetched version
+	if input.Params.DryRun {
+		plannedRequests := netbox.PlannedRequests()
+		fmt.Fprintf(os.Stderr, "dry run, %d requests planned:\n", len(plannedRequests))
+		for _, request := range plannedRequests {
+			fmt.Fprintln(os.Stderr, request.Diff())
+		}
+
+		dryRunMetadata, err := dryRunMetadata(plannedRequests)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to encode planned requests: %w", err))
+			os.Exit(1)
+		}
+		output.Version = fetched.Version
+		output.Metadata = append(output.Metadata, dryRunMetadata...)
+	}
+
 	if err := json.NewEncoder(os.Stdout).Encode(output); err != nil {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to write JSON to stdout: %w", err))
 	}
 }
 
-func validateOutInput(stdin io.Reader) (concourse.Input, concourse.Input, error) {
+func validateOutInput(stdin io.Reader, path string) (concourse.Input, concourse.Input, error) {
 	var (
 		sourceParsed  concourse.Input
 		versionParsed concourse.Input
 		err           error
 	)
 
-	if len(os.Args) < 2 {
-		return concourse.Input{}, concourse.Input{}, fmt.Errorf("destination path argument is required")
+	if err = helper.ValidateDirectory(path); err != nil {
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("invalid source path: %w", err)
+	}
+
+	err = json.NewDecoder(stdin).Decode(&sourceParsed)
+	if err != nil && err != io.EOF {
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("failed to decode stdin: %w", err)
+	}
+
+	if sourceParsed.Source.Url == "" {
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("source.url containing the NetBox URL is required")
 	}
 
-	path := os.Args[1]
-	if path != helper.ConcourseInputPath {
-		return concourse.Input{}, concourse.Input{}, fmt.Errorf("invalid source path: %s", path)
+	sourceParsed.Params, err = loadParamFiles(sourceParsed.Params, path)
+	if err != nil {
+		return concourse.Input{}, concourse.Input{}, err
+	}
+
+	if sourceParsed.Params.Acquire && sourceParsed.Params.Release {
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("params.acquire and params.release are mutually exclusive")
+	}
+	if (sourceParsed.Params.Acquire || sourceParsed.Params.Release) && sourceParsed.Source.Lock == nil {
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("params.acquire and params.release require source.lock")
+	}
+	if sourceParsed.Params.Force && !sourceParsed.Params.Release {
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("params.force requires params.release")
+	}
+	// the claimed device replaces the fetched version
+	if sourceParsed.Params.Acquire {
+		return sourceParsed, concourse.Input{}, nil
+	}
+	if !versionRequired(sourceParsed.Params) {
+		return sourceParsed, concourse.Input{Version: setupVersion(time.Now())}, nil
 	}
 
-	file, err := os.ReadFile(path + "/version.json")
+	versionPath := helper.ResolvePath(path, versionFileName(sourceParsed.Params))
+	file, err := os.ReadFile(versionPath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to read input file %s: %w", path+"/version.json", err))
-		os.Exit(1)
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("failed to read input file %s: %w", versionPath, err)
 	}
 
 	err = json.NewDecoder(bytes.NewReader(file)).Decode(&versionParsed)
 	if err != nil && err != io.EOF {
-		return concourse.Input{}, concourse.Input{}, fmt.Errorf("failed to decode version from %s: %w", path+"/version.json", err)
+		return concourse.Input{}, concourse.Input{}, fmt.Errorf("failed to decode version from %s: %w", versionPath, err)
 	}
+	versionParsed.Version = clearStepResults(versionParsed.Version)
+	return sourceParsed, versionParsed, nil
+}
 
-	err = json.NewDecoder(stdin).Decode(&sourceParsed)
-	if err != nil && err != io.EOF {
-		return concourse.Input{}, concourse.Input{}, fmt.Errorf("failed to decode stdin: %w", err)
+// versionRequired reports whether the params act on the device or interface of the fetched version, puts with only
+// apply, objects, bulk or register_webhook params are independent of it
+func versionRequired(params concourse.Params) bool {
+	standalone := params.Apply != nil || params.Objects != nil || params.Bulk != nil || params.RegisterWebhook != nil
+	device := len(params.Status) > 0 || len(params.CustomFields) > 0 || len(params.AddTags) > 0 || len(params.RemoveTags) > 0 ||
+		params.Interface != nil || params.LocalContext != nil || params.AllocateIp != nil || params.AllocatePrefix != nil ||
+		params.AllocateVlan != nil || params.Script != nil || params.Lldp != nil || params.Journal != nil || params.Acquire || params.Release
+	return device || !standalone
+}
+
+// setupVersion identifies a put without device or interface by its time, as Concourse requires a version for each put
+func setupVersion(now time.Time) concourse.Version {
+	return concourse.Version{Id: "0", LastUpdated: now.UTC().Format(time.RFC3339), ObjectType: setupObjectType}
+}
+
+// the results of allocations and scripts describe the put, which produced the version, so they are not carried over
+func clearStepResults(version concourse.Version) concourse.Version {
+	version.AllocatedIp = ""
+	version.AllocatedPrefix = ""
+	version.AllocatedVlan = ""
+	version.ScriptJob = ""
+	return version
+}
+
+func loadParamFiles(params concourse.Params, path string) (concourse.Params, error) {
+	if len(params.CustomFieldsFile) > 0 {
+		customFields, err := helper.ReadDataFile(helper.ResolvePath(path, params.CustomFieldsFile))
+		if err != nil {
+			return params, fmt.Errorf("invalid params.custom_fields_file: %w", err)
+		}
+		// literal values take precedence over the values from the file
+		maps.Copy(customFields, params.CustomFields)
+		params.CustomFields = customFields
 	}
 
-	if sourceParsed.Source.Url == "" {
-		return concourse.Input{}, concourse.Input{}, fmt.Errorf("source.url containing the NetBox URL is required")
+	if len(params.InterfaceFile) > 0 {
+		var (
+			iface concourse.Interface
+		)
+
+		interfaceData, err := helper.ReadDataFile(helper.ResolvePath(path, params.InterfaceFile))
+		if err != nil {
+			return params, fmt.Errorf("invalid params.interface_file: %w", err)
+		}
+		// decode the file first and the literal values on top, so they take precedence
+		for _, source := range []any{interfaceData, params.Interface} {
+			sourceBytes, err := json.Marshal(source)
+			if err != nil {
+				return params, fmt.Errorf("failed to encode interface attributes: %w", err)
+			}
+			if err := json.Unmarshal(sourceBytes, &iface); err != nil {
+				return params, fmt.Errorf("invalid interface attributes in params.interface_file: %w", err)
+			}
+		}
+		params.Interface = &iface
 	}
-	return sourceParsed, versionParsed, nil
+
+	if params.Script != nil && len(params.Script.DataFile) > 0 {
+		data, err := helper.ReadDataFile(helper.ResolvePath(path, params.Script.DataFile))
+		if err != nil {
+			return params, fmt.Errorf("invalid params.script.data_file: %w", err)
+		}
+		// literal values take precedence over the values from the file
+		maps.Copy(data, params.Script.Data)
+		params.Script.Data = data
+	}
+
+	if params.LocalContext != nil && len(params.LocalContext.File) == 0 && params.LocalContext.Data == nil {
+		return params, fmt.Errorf("params.local_context requires file or data")
+	}
+	if params.LocalContext != nil && len(params.LocalContext.File) > 0 {
+		if params.LocalContext.Data != nil {
+			return params, fmt.Errorf("params.local_context accepts either file or data")
+		}
+		if err := helper.DecodeDataFile(helper.ResolvePath(path, params.LocalContext.File), &params.LocalContext.Data); err != nil {
+			return params, fmt.Errorf("invalid params.local_context.file: %w", err)
+		}
+	}
+
+	if params.Apply != nil && len(params.Apply.File) > 0 {
+		var (
+			state concourse.State
+		)
+
+		stateData, err := helper.ReadDataFile(helper.ResolvePath(path, params.Apply.File))
+		if err != nil {
+			return params, fmt.Errorf("invalid params.apply.file: %w", err)
+		}
+		stateBytes, err := json.Marshal(stateData)
+		if err != nil {
+			return params, fmt.Errorf("failed to encode desired state: %w", err)
+		}
+		if err := json.Unmarshal(stateBytes, &state); err != nil {
+			return params, fmt.Errorf("invalid desired state in params.apply.file: %w", err)
+		}
+		params.Apply.State = &state
+	}
+
+	if params.Objects != nil && len(params.Objects.File) > 0 {
+		var (
+			spec concourse.ObjectSpec
+		)
+
+		specData, err := helper.ReadDataFile(helper.ResolvePath(path, params.Objects.File))
+		if err != nil {
+			return params, fmt.Errorf("invalid params.objects.file: %w", err)
+		}
+		specBytes, err := json.Marshal(specData)
+		if err != nil {
+			return params, fmt.Errorf("failed to encode object spec: %w", err)
+		}
+		if err := json.Unmarshal(specBytes, &spec); err != nil {
+			return params, fmt.Errorf("invalid object spec in params.objects.file: %w", err)
+		}
+		params.Objects.Spec = &spec
+	}
+
+	if params.Bulk != nil && len(params.Bulk.File) > 0 {
+		var (
+			updateData any
+			updates    []concourse.BulkUpdate
+		)
+
+		if err := helper.DecodeDataFile(helper.ResolvePath(path, params.Bulk.File), &updateData); err != nil {
+			return params, fmt.Errorf("invalid params.bulk.file: %w", err)
+		}
+		updateBytes, err := json.Marshal(updateData)
+		if err != nil {
+			return params, fmt.Errorf("failed to encode bulk updates: %w", err)
+		}
+		if err := json.Unmarshal(updateBytes, &updates); err != nil {
+			return params, fmt.Errorf("invalid bulk updates in params.bulk.file, expected a list: %w", err)
+		}
+		// the literal updates are sent after the updates from the file
+		params.Bulk.Updates = append(updates, params.Bulk.Updates...)
+	}
+
+	if params.Lldp != nil && len(params.Lldp.File) > 0 {
+		var (
+			neighborData any
+			neighbors    []concourse.LldpNeighbor
+		)
+
+		if err := helper.DecodeDataFile(helper.ResolvePath(path, params.Lldp.File), &neighborData); err != nil {
+			return params, fmt.Errorf("invalid params.lldp.file: %w", err)
+		}
+		neighborBytes, err := json.Marshal(neighborData)
+		if err != nil {
+			return params, fmt.Errorf("failed to encode LLDP neighbors: %w", err)
+		}
+		if err := json.Unmarshal(neighborBytes, &neighbors); err != nil {
+			return params, fmt.Errorf("invalid LLDP neighbors in params.lldp.file, expected a list: %w", err)
+		}
+		params.Lldp.Neighbors = append(neighbors, params.Lldp.Neighbors...)
+	}
+	return params, nil
+}
+
+func journalComment(journal concourse.Journal, path string) (string, error) {
+	commentTemplate := journal.Comment
+	if len(commentTemplate) == 0 {
+		commentTemplate = defaultJournalComment
+	}
+
+	comment, err := render.String("params.journal.comment", commentTemplate, helper.BuildMetadata())
+	if err != nil {
+		return "", err
+	}
+
+	if len(journal.CommentFile) > 0 {
+		commentFile, err := os.ReadFile(helper.ResolvePath(path, journal.CommentFile))
+		if err != nil {
+			return "", fmt.Errorf("invalid params.journal.comment_file: %w", err)
+		}
+		comment = strings.TrimSpace(comment) + "\n\n" + string(commentFile)
+	}
+	return comment, nil
+}
+
+func changelogMessage(params concourse.Params) (string, error) {
+	messageTemplate := defaultChangelogMessage
+	if params.ChangelogMessage != nil {
+		messageTemplate = *params.ChangelogMessage
+	}
+
+	message, err := render.String("params.changelog_message", messageTemplate, helper.BuildMetadata())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(message), nil
+}
+
+func allocationMetadata(version concourse.Version) []concourse.Metadata {
+	metadata := []concourse.Metadata{}
+	for _, allocation := range []concourse.Metadata{
+		{Name: "allocated_ip", Value: version.AllocatedIp},
+		{Name: "allocated_prefix", Value: version.AllocatedPrefix},
+		{Name: "allocated_vlan", Value: version.AllocatedVlan},
+	} {
+		if len(allocation.Value) > 0 {
+			metadata = append(metadata, allocation)
+		}
+	}
+	return metadata
+}
+
+func applyMetadata(name string, plan []netbox.PlannedChange) []concourse.Metadata {
+	counts := map[string]int{}
+	lines := make([]string, 0, len(plan))
+	for _, change := range plan {
+		counts[change.Action]++
+		lines = append(lines, change.String())
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "no changes")
+	}
+	return []concourse.Metadata{
+		{Name: name + "_plan", Value: strings.Join(lines, "\n")},
+		{Name: name + "_result", Value: fmt.Sprintf("%d created, %d updated, %d deleted", counts["create"], counts["update"], counts["delete"])},
+	}
+}
+
+func lldpMetadata(mismatches []netbox.CableMismatch) []concourse.Metadata {
+	counts := map[string]int{}
+	lines := []string{}
+	for _, mismatch := range mismatches {
+		counts[mismatch.Kind]++
+		if mismatch.Kind != "match" {
+			lines = append(lines, mismatch.String())
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "no mismatches")
+	}
+	return []concourse.Metadata{
+		{Name: "lldp_mismatches", Value: strings.Join(lines, "\n")},
+		{Name: "lldp_result", Value: fmt.Sprintf("%d matched, %d missing, %d wrong, %d unknown", counts["match"], counts["missing"], counts["wrong"], counts["unknown"])},
+	}
+}
+
+// the metadata of a failed put is discarded, so the changes executed before the failure are printed
+func printAppliedChanges(changes []netbox.PlannedChange) {
+	fmt.Fprintf(os.Stderr, "%d changes applied before the failure:\n", len(changes))
+	for _, change := range changes {
+		fmt.Fprintln(os.Stderr, change)
+	}
+}
+
+func printScriptLog(result netbox.ScriptResult) {
+	entries, _ := result.Log.([]any)
+	for _, entry := range entries {
+		fields, _ := entry.(map[string]any)
+		status, _ := fields["status"].(string)
+		message, _ := fields["message"].(string)
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", status, message)
+	}
+	if len(result.Output) > 0 {
+		fmt.Fprintln(os.Stderr, result.Output)
+	}
+}
+
+func concurrentChangesMetadata(changes []netbox.FieldDiff) concourse.Metadata {
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	return concourse.Metadata{Name: "concurrent_changes", Value: strings.Join(fields, ", ")}
+}
+
+func dryRunMetadata(requests []netbox.PlannedRequest) ([]concourse.Metadata, error) {
+	requestsBytes, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+	return []concourse.Metadata{
+		{Name: "dry_run", Value: "true"},
+		{Name: "planned_requests", Value: string(requestsBytes)},
+	}, nil
+}
+
+func versionFileName(params concourse.Params) string {
+	if len(params.VersionFile) > 0 {
+		return params.VersionFile
+	}
+	return "version.json"
 }
@@ -3,9 +3,10 @@ package app
 import (
 	"bytes"
 	"encoding/json"
-	"flag"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
@@ -21,39 +22,49 @@ func TestValidateOutInput(t *testing.T) {
 	)
 
 	tests := []struct {
-		name    string
-		stdin   string
-		osArg   string
-		wantErr bool
+		name        string
+		stdin       string
+		versionFile string
+		useTempDir  bool
+		wantErr     bool
 	}{
-		{"missingInputPath", helper.ConcourseSourceConfig, "", true},
-		{"missingSourceUrl", helper.ConcourseInvalidSourceConfig, helper.ConcourseInputPath, true},
-		{"validInput", helper.ConcourseSourceConfig, helper.ConcourseInputPath, false},
+		{"missingInputPath", helper.ConcourseSourceConfig, "", false, true},
+		{"missingSourceUrl", helper.ConcourseInvalidSourceConfig, "version.json", true, true},
+		{"missingVersionFile", helper.ConcourseSourceConfig, "", true, true},
+		{"validInput", helper.ConcourseSourceConfig, "version.json", true, false},
+		{"validInputVersionFileInInput", helper.ConcourseSourceConfig, "example.netbox/version.json", true, false},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			sourceConfig = concourse.Input{}
 			err = json.Unmarshal([]byte(test.stdin), &sourceConfig)
 			if err != nil && err != io.EOF {
 				t.Errorf("failed to decode test.input: %v", err)
 			}
+			sourceConfig.Params.VersionFile = test.versionFile
 
 			sourceConfigBytes, err = json.Marshal(sourceConfig)
 			if err != nil && err != io.EOF {
 				t.Errorf("failed to encode test.input: %v", err)
 			}
 
-			if len(test.osArg) > 0 {
-				filepath := test.osArg + "/version.json"
+			inputPath := ""
+			if test.useTempDir {
+				inputPath = t.TempDir()
+			}
+
+			if test.useTempDir && len(test.versionFile) > 0 {
+				versionPath := filepath.Join(inputPath, test.versionFile)
 
-				err = helper.EnsureFolder(test.osArg)
+				err = helper.EnsureFolder(filepath.Dir(versionPath))
 				if err != nil {
-					t.Errorf("error creating folder %s: '%v', error expected: %v", test.osArg, err, test.wantErr)
+					t.Errorf("error creating folder %s: '%v', error expected: %v", filepath.Dir(versionPath), err, test.wantErr)
 				}
 
-				file, err := os.Create(filepath)
+				file, err := os.Create(versionPath)
 				if err != nil {
-					t.Errorf("failed to create %s file: %v", filepath, err)
+					t.Errorf("failed to create %s file: %v", versionPath, err)
 				}
 				defer func() {
 					if err := file.Close(); err != nil {
@@ -67,18 +78,271 @@ func TestValidateOutInput(t *testing.T) {
 				}
 
 				if err := json.NewEncoder(file).Encode(fetchedVersion); err != nil {
-					t.Errorf("failed to write JSON to %s: %v", filepath, err)
+					t.Errorf("failed to write JSON to %s: %v", versionPath, err)
 				}
-
-				os.Args[1] = test.osArg
-				flag.Parse()
 			}
 
 			stdinReader := bytes.NewReader(sourceConfigBytes)
-			_, _, err := validateOutInput(stdinReader)
+			_, _, err := validateOutInput(stdinReader, inputPath)
 			if (err != nil) != test.wantErr {
 				t.Errorf("validateInput() error: '%v', error expected: %v", err, test.wantErr)
 			}
 		})
 	}
 }
+
+func TestValidateOutInputWithoutVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  concourse.Params
+		wantErr bool
+	}{
+		{"registerWebhookOnly", concourse.Params{RegisterWebhook: &concourse.RegisterWebhook{Name: "netbox-events", Url: "https://ci.example.local/hook"}}, false},
+		{"bulkOnly", concourse.Params{Bulk: &concourse.Bulk{Updates: []concourse.BulkUpdate{{Id: 1, Fields: map[string]any{"status": "active"}}}}}, false},
+		{"registerWebhookWithStatus", concourse.Params{Status: "active", RegisterWebhook: &concourse.RegisterWebhook{Name: "netbox-events", Url: "https://ci.example.local/hook"}}, true},
+		{"noParams", concourse.Params{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdin, err := json.Marshal(concourse.Input{Source: concourse.Source{Url: "https://netbox.example.local"}, Params: test.params})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, fetched, err := validateOutInput(bytes.NewReader(stdin), t.TempDir())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validateOutInput() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if !test.wantErr && (fetched.Version.ObjectType != setupObjectType || len(fetched.Version.LastUpdated) == 0) {
+				t.Errorf("expected setup version, got %+v", fetched.Version)
+			}
+		})
+	}
+}
+
+func TestClearStepResults(t *testing.T) {
+	version := concourse.Version{
+		Id:              "123",
+		LastUpdated:     "2025-01-02T03:04:05Z",
+		ObjectType:      "devices",
+		AllocatedIp:     "10.0.0.5/24",
+		AllocatedPrefix: "10.1.0.0/28",
+		AllocatedVlan:   "150",
+		ScriptJob:       "42",
+	}
+	expected := concourse.Version{Id: "123", LastUpdated: "2025-01-02T03:04:05Z", ObjectType: "devices"}
+
+	if result := clearStepResults(version); result != expected {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+	if len(allocationMetadata(clearStepResults(version))) != 0 {
+		t.Error("expected no allocation metadata of an earlier put")
+	}
+}
+
+func TestLoadParamFiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileName     string
+		fileContent  string
+		customFields map[string]any
+		expected     map[string]any
+		wantErr      bool
+	}{
+		{"noFile", "", "", map[string]any{"firmware_version": "1.2.3"}, map[string]any{"firmware_version": "1.2.3"}, false},
+		{"jsonFile", "facts/custom_fields.json", `{"bios_version": "2.1"}`, nil, map[string]any{"bios_version": "2.1"}, false},
+		{"yamlFile", "facts/custom_fields.yaml", "bios_version: \"2.1\"\n", nil, map[string]any{"bios_version": "2.1"}, false},
+		{"literalPrecedence", "facts/custom_fields.yaml", "bios_version: \"2.1\"\nfirmware_version: \"1.0.0\"\n", map[string]any{"firmware_version": "1.2.3"}, map[string]any{"bios_version": "2.1", "firmware_version": "1.2.3"}, false},
+		{"missingFile", "facts/missing.yaml", "", nil, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inputPath := t.TempDir()
+			if len(test.fileContent) > 0 {
+				filePath := filepath.Join(inputPath, test.fileName)
+				if err := helper.EnsureFolder(filepath.Dir(filePath)); err != nil {
+					t.Fatalf("error creating folder %s: %v", filepath.Dir(filePath), err)
+				}
+				if err := os.WriteFile(filePath, []byte(test.fileContent), 0644); err != nil {
+					t.Fatalf("failed to create %s file: %v", filePath, err)
+				}
+			}
+
+			params, err := loadParamFiles(concourse.Params{CustomFields: test.customFields, CustomFieldsFile: test.fileName}, inputPath)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("loadParamFiles() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(params.CustomFields, test.expected) {
+				t.Errorf("expected custom fields %v, got %v", test.expected, params.CustomFields)
+			}
+		})
+	}
+}
+
+func TestLoadParamFilesInterface(t *testing.T) {
+	description := "applied by switchport automation"
+	inputPath := t.TempDir()
+	filePath := filepath.Join(inputPath, "switchport", "applied.yaml")
+	if err := helper.EnsureFolder(filepath.Dir(filePath)); err != nil {
+		t.Fatalf("error creating folder %s: %v", filepath.Dir(filePath), err)
+	}
+	if err := os.WriteFile(filePath, []byte("enabled: true\nmtu: 1500\ndescription: uplink\ntagged_vlans: [11, 12]\n"), 0644); err != nil {
+		t.Fatalf("failed to create %s file: %v", filePath, err)
+	}
+
+	params, err := loadParamFiles(concourse.Params{
+		Interface:     &concourse.Interface{Description: &description},
+		InterfaceFile: "switchport/applied.yaml",
+	}, inputPath)
+	if err != nil {
+		t.Fatalf("loadParamFiles() error: '%v'", err)
+	}
+
+	iface := params.Interface
+	if iface == nil || iface.Enabled == nil || !*iface.Enabled {
+		t.Errorf("expected enabled from file, got %v", iface)
+	}
+	if iface.Mtu == nil || *iface.Mtu != 1500 {
+		t.Errorf("expected mtu 1500 from file, got %v", iface.Mtu)
+	}
+	if iface.Description == nil || *iface.Description != description {
+		t.Errorf("expected literal description '%s', got %v", description, iface.Description)
+	}
+	if !reflect.DeepEqual(iface.TaggedVlans, []int32{11, 12}) {
+		t.Errorf("expected tagged vlans [11 12] from file, got %v", iface.TaggedVlans)
+	}
+}
+
+func TestJournalComment(t *testing.T) {
+	t.Setenv("ATC_EXTERNAL_URL", "https://concourse.example.local")
+	t.Setenv("BUILD_TEAM_NAME", "main")
+	t.Setenv("BUILD_PIPELINE_NAME", "provisioning")
+	t.Setenv("BUILD_JOB_NAME", "deploy")
+	t.Setenv("BUILD_NAME", "42")
+
+	tests := []struct {
+		name        string
+		journal     concourse.Journal
+		fileContent string
+		expected    string
+		wantErr     bool
+	}{
+		{"defaultComment", concourse.Journal{}, "", "Updated by Concourse build [provisioning/deploy #42](https://concourse.example.local/teams/main/pipelines/provisioning/jobs/deploy/builds/42)", false},
+		{"customComment", concourse.Journal{Comment: "{{ .BUILD_JOB_NAME }} #{{ .BUILD_NAME }} done"}, "", "deploy #42 done", false},
+		{"commentFile", concourse.Journal{Comment: "{{ .BUILD_JOB_NAME }} done", CommentFile: "deploy/summary.md"}, "3 hosts deployed\n", "deploy done\n\n3 hosts deployed\n", false},
+		{"unknownVariable", concourse.Journal{Comment: "{{ .BUILD_UNKNOWN }}"}, "", "", true},
+		{"missingCommentFile", concourse.Journal{CommentFile: "deploy/missing.md"}, "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inputPath := t.TempDir()
+			if len(test.fileContent) > 0 {
+				filePath := filepath.Join(inputPath, test.journal.CommentFile)
+				if err := helper.EnsureFolder(filepath.Dir(filePath)); err != nil {
+					t.Fatalf("error creating folder %s: %v", filepath.Dir(filePath), err)
+				}
+				if err := os.WriteFile(filePath, []byte(test.fileContent), 0644); err != nil {
+					t.Fatalf("failed to create %s file: %v", filePath, err)
+				}
+			}
+
+			comment, err := journalComment(test.journal, inputPath)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("journalComment() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if comment != test.expected {
+				t.Errorf("expected comment '%s', got '%s'", test.expected, comment)
+			}
+		})
+	}
+}
+
+func TestLoadParamFilesApply(t *testing.T) {
+	inputPath := t.TempDir()
+	filePath := filepath.Join(inputPath, "inventory", "netbox.yaml")
+	if err := helper.EnsureFolder(filepath.Dir(filePath)); err != nil {
+		t.Fatalf("error creating folder %s: %v", filepath.Dir(filePath), err)
+	}
+	content := "devices:\n  - site: site-a\n    name: server01\n    tags: []\n    interfaces:\n      - name: eth0\n        mtu: 9000\n"
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create %s file: %v", filePath, err)
+	}
+
+	params, err := loadParamFiles(concourse.Params{Apply: &concourse.Apply{File: "inventory/netbox.yaml"}}, inputPath)
+	if err != nil {
+		t.Fatalf("loadParamFiles() error: '%v'", err)
+	}
+
+	state := params.Apply.State
+	if state == nil || len(state.Devices) != 1 || state.Devices[0].Name != "server01" {
+		t.Fatalf("expected device server01 from file, got %v", state)
+	}
+	if state.Devices[0].Tags == nil {
+		t.Errorf("expected declared empty tags to be kept")
+	}
+	if len(state.Devices[0].Interfaces) != 1 || state.Devices[0].Interfaces[0].Mtu == nil || *state.Devices[0].Interfaces[0].Mtu != 9000 {
+		t.Errorf("expected interface eth0 with mtu 9000 from file, got %v", state.Devices[0].Interfaces)
+	}
+}
+
+func TestLoadParamFilesBulk(t *testing.T) {
+	inputPath := t.TempDir()
+	filePath := filepath.Join(inputPath, "firmware_updates.yaml")
+	content := "- id: 1\n  fields:\n    serial: ABC\n- object_type: interfaces\n  id: 2\n  fields:\n    mtu: 9000\n"
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create %s file: %v", filePath, err)
+	}
+
+	literal := concourse.BulkUpdate{Id: 3, Fields: map[string]any{"serial": "GHI"}}
+	params, err := loadParamFiles(concourse.Params{Bulk: &concourse.Bulk{File: "firmware_updates.yaml", Updates: []concourse.BulkUpdate{literal}}}, inputPath)
+	if err != nil {
+		t.Fatalf("loadParamFiles() error: '%v'", err)
+	}
+
+	updates := params.Bulk.Updates
+	if len(updates) != 3 || updates[0].Id != 1 || updates[1].ObjectType != "interfaces" || updates[2].Id != 3 {
+		t.Fatalf("expected the updates from file followed by the literal update, got %v", updates)
+	}
+	if updates[1].Fields["mtu"] != float64(9000) {
+		t.Errorf("expected mtu 9000 from file, got %v", updates[1].Fields["mtu"])
+	}
+}
+
+func TestChangelogMessage(t *testing.T) {
+	t.Setenv("ATC_EXTERNAL_URL", "https://concourse.example.local")
+	t.Setenv("BUILD_TEAM_NAME", "main")
+	t.Setenv("BUILD_PIPELINE_NAME", "provisioning")
+	t.Setenv("BUILD_JOB_NAME", "deploy")
+	t.Setenv("BUILD_NAME", "42")
+
+	custom := "{{ .BUILD_JOB_NAME }} #{{ .BUILD_NAME }}"
+	disabled := ""
+	unknown := "{{ .BUILD_UNKNOWN }}"
+
+	tests := []struct {
+		name     string
+		message  *string
+		expected string
+		wantErr  bool
+	}{
+		{"defaultMessage", nil, "Updated by Concourse build provisioning/deploy #42 https://concourse.example.local/teams/main/pipelines/provisioning/jobs/deploy/builds/42", false},
+		{"customMessage", &custom, "deploy #42", false},
+		{"disabled", &disabled, "", false},
+		{"unknownVariable", &unknown, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := changelogMessage(concourse.Params{ChangelogMessage: test.message})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("changelogMessage() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if message != test.expected {
+				t.Errorf("expected message '%s', got '%s'", test.expected, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/relay"
+)
+
+const (
+	defaultRelayListen   string        = ":8080"
+	defaultRelayDebounce time.Duration = 5 * time.Second
+)
+
+var (
+	UsageRelay string = `This command runs an HTTP server, which receives NetBox webhooks and triggers the check webhooks of Concourse resources.
+The configuration is read in JSON format from stdin. The X-Hook-Signature header of each webhook is verified with the secret
+configured for the NetBox webhook. The changed object is matched against the filter of each rule like the check command does,
+and the webhook_url of matching rules is called. Matches of a rule within the debounce duration are coalesced into one call.
+GET /healthz can be used as health check.
+
+{
+  "listen": ":8080",
+  "secret": "netbox-webhook-secret",
+  "debounce": "5s",
+  "rules": [
+    {
+      "name": "example.netbox",
+      "filter": {
+        "site_name": ["site-a"],
+        "role": ["server"],
+        "device_status": ["active"]
+      },
+      "webhook_url": "https://concourse.example.local/api/v1/teams/main/pipelines/provisioning/resources/example.netbox/check/webhook?webhook_token=token"
+    }
+  ]
+}
+
+Example: relay < relay.json
+`
+)
+
+func Relay() {
+	config, debounce, err := validateRelayInput(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("input validation failed: %w", err))
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	debouncer := relay.NewDebouncer(debounce, func(rule relay.Rule) {
+		// pending calls are flushed after the shutdown signal, so they are not bound to ctx
+		relay.CallWebhook(httpClient, rule, context.Background())
+	})
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           relay.NewHandler(config, debouncer),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to shut down relay: %w", err))
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "relaying NetBox webhooks on %s to %d rules\n", config.Listen, len(config.Rules))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("relay failed: %w", err))
+		os.Exit(1)
+	}
+	debouncer.Flush()
+}
+
+func validateRelayInput(stdin io.Reader) (relay.Config, time.Duration, error) {
+	var (
+		config relay.Config
+	)
+
+	err := json.NewDecoder(stdin).Decode(&config)
+	if err != nil && err != io.EOF {
+		return relay.Config{}, 0, fmt.Errorf("failed to decode stdin: %w", err)
+	}
+
+	if len(config.Secret) == 0 {
+		return relay.Config{}, 0, fmt.Errorf("secret of the NetBox webhook is required to verify the signature")
+	}
+	if len(config.Rules) == 0 {
+		return relay.Config{}, 0, fmt.Errorf("at least one rule is required")
+	}
+	names := map[string]bool{}
+	for _, rule := range config.Rules {
+		if len(rule.Name) == 0 || len(rule.WebhookUrl) == 0 {
+			return relay.Config{}, 0, fmt.Errorf("rules require name and webhook_url")
+		}
+		if names[rule.Name] {
+			return relay.Config{}, 0, fmt.Errorf("rule %s is defined more than once", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	if len(config.Listen) == 0 {
+		config.Listen = defaultRelayListen
+	}
+
+	debounce := defaultRelayDebounce
+	if len(config.Debounce) > 0 {
+		debounce, err = time.ParseDuration(config.Debounce)
+		if err != nil || debounce < 0 {
+			return relay.Config{}, 0, fmt.Errorf("invalid debounce duration: %s", config.Debounce)
+		}
+	}
+	return config, debounce, nil
+}
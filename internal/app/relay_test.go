@@ -0,0 +1,45 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateRelayInput(t *testing.T) {
+	rule := `{"name": "example.netbox", "webhook_url": "https://concourse.example.local/hook"}`
+
+	tests := []struct {
+		name     string
+		stdin    string
+		debounce time.Duration
+		wantErr  bool
+	}{
+		{"noInput", "", 0, true},
+		{"missingSecret", `{"rules": [` + rule + `]}`, 0, true},
+		{"missingRules", `{"secret": "secret"}`, 0, true},
+		{"duplicateRule", `{"secret": "secret", "rules": [` + rule + `, ` + rule + `]}`, 0, true},
+		{"missingWebhookUrl", `{"secret": "secret", "rules": [{"name": "example.netbox"}]}`, 0, true},
+		{"invalidDebounce", `{"secret": "secret", "debounce": "soon", "rules": [` + rule + `]}`, 0, true},
+		{"defaults", `{"secret": "secret", "rules": [` + rule + `]}`, defaultRelayDebounce, false},
+		{"debounce", `{"secret": "secret", "debounce": "30s", "rules": [` + rule + `]}`, 30 * time.Second, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, debounce, err := validateRelayInput(strings.NewReader(test.stdin))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validateRelayInput() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if debounce != test.debounce {
+				t.Errorf("expected debounce %v, got %v", test.debounce, debounce)
+			}
+			if config.Listen != defaultRelayListen {
+				t.Errorf("expected listen address %s, got %s", defaultRelayListen, config.Listen)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/netbox"
+	"github.com/sapcc/concourse-netbox-resource/internal/watch"
+)
+
+const (
+	defaultWatchInterval time.Duration = time.Minute
+)
+
+var (
+	UsageWatch string = `This command queries NetBox like the check command in an interval outside of Concourse, e.g. from systemd or Kubernetes.
+The configuration is read in JSON format from stdin. The last seen version is persisted in the state_file, and only newer
+versions are handled. Each new version is written as JSON line to stdout, or passed to the command as JSON on stdin and in the
+NETBOX_ID, NETBOX_OBJECT_TYPE, NETBOX_LAST_UPDATED, NETBOX_DEVICE_ID, NETBOX_DEVICE_NAME and NETBOX_INTERFACE_NAME
+environment variables. The state is only advanced after the command succeeded. With once a single query is run, e.g. in a CronJob.
+
+{
+  "source": {
+    "url": "https://netbox.example.local",
+    "token": "your-api-token",
+    "filter": {
+      "site_name": ["site-a"],
+      "role": ["server"],
+      "device_status": ["active"]
+    }
+  },
+  "interval": "1m",
+  "state_file": "/var/lib/netbox-watch/state.json",
+  "command": ["/usr/local/bin/provision", "--verbose"],
+  "once": false
+}
+
+Example: watch < watch.json
+`
+)
+
+func Watch() {
+	config, interval, err := validateWatchInput(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("input validation failed: %w", err))
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		handled, err := watch.Poll(config, netbox.Query, os.Stdout, ctx)
+		if handled > 0 {
+			fmt.Fprintf(os.Stderr, "handled %d new versions\n", handled)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("watch failed: %w", err))
+			// the failed version is retried in the next interval
+			if config.Once {
+				os.Exit(1)
+			}
+		}
+		if config.Once {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func validateWatchInput(stdin io.Reader) (watch.Config, time.Duration, error) {
+	var (
+		config watch.Config
+	)
+
+	err := json.NewDecoder(stdin).Decode(&config)
+	if err != nil && err != io.EOF {
+		return watch.Config{}, 0, fmt.Errorf("failed to decode stdin: %w", err)
+	}
+
+	if config.Source.Url == "" {
+		return watch.Config{}, 0, fmt.Errorf("source.url containing the NetBox URL is required")
+	}
+	if len(config.StateFile) == 0 {
+		return watch.Config{}, 0, fmt.Errorf("state_file is required to persist the last seen version")
+	}
+	if len(config.Command) > 0 && len(config.Command[0]) == 0 {
+		return watch.Config{}, 0, fmt.Errorf("command requires the executable as first element")
+	}
+
+	interval := defaultWatchInterval
+	if len(config.Interval) > 0 {
+		interval, err = time.ParseDuration(config.Interval)
+		if err != nil || interval <= 0 {
+			return watch.Config{}, 0, fmt.Errorf("invalid interval duration: %s", config.Interval)
+		}
+	}
+	return config, interval, nil
+}
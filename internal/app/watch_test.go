@@ -0,0 +1,39 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateWatchInput(t *testing.T) {
+	source := `"source": {"url": "https://netbox.example.local"}`
+
+	tests := []struct {
+		name     string
+		stdin    string
+		interval time.Duration
+		wantErr  bool
+	}{
+		{"noInput", "", 0, true},
+		{"missingUrl", `{"state_file": "state.json"}`, 0, true},
+		{"missingStateFile", `{` + source + `}`, 0, true},
+		{"emptyCommand", `{` + source + `, "state_file": "state.json", "command": [""]}`, 0, true},
+		{"invalidInterval", `{` + source + `, "state_file": "state.json", "interval": "often"}`, 0, true},
+		{"zeroInterval", `{` + source + `, "state_file": "state.json", "interval": "0s"}`, 0, true},
+		{"defaults", `{` + source + `, "state_file": "state.json"}`, defaultWatchInterval, false},
+		{"interval", `{` + source + `, "state_file": "state.json", "interval": "30s", "command": ["true"]}`, 30 * time.Second, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, interval, err := validateWatchInput(strings.NewReader(test.stdin))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validateWatchInput() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if interval != test.interval {
+				t.Errorf("expected interval %v, got %v", test.interval, interval)
+			}
+		})
+	}
+}
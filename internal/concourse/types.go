@@ -7,6 +7,7 @@ import (
 type Input struct {
 	Source  Source  `json:"source"`
 	Version Version `json:"version,omitempty"`
+	Params  Params  `json:"params,omitempty"`
 }
 
 type Output struct {
@@ -18,6 +19,218 @@ type Source struct {
 	Url    string              `json:"url"`
 	Token  string              `json:"token,omitempty"`
 	Filter filter.NetboxObject `json:"filter,omitempty"`
+	Lock   *Lock               `json:"lock,omitempty"`
+}
+
+type Lock struct {
+	CustomField string `json:"custom_field"`
+	Tag         string `json:"tag,omitempty"`
+}
+
+type Params struct {
+	Template         string           `json:"template,omitempty"`
+	TemplateContent  string           `json:"template_content,omitempty"`
+	TemplateOutput   string           `json:"template_output,omitempty"`
+	OnMissing        string           `json:"on_missing,omitempty"`
+	Changes          bool             `json:"changes,omitempty"`
+	ChangesSince     string           `json:"changes_since,omitempty"`
+	VersionFile      string           `json:"version_file,omitempty"`
+	Status           string           `json:"status,omitempty"`
+	CustomFields     map[string]any   `json:"custom_fields,omitempty"`
+	CustomFieldsFile string           `json:"custom_fields_file,omitempty"`
+	AddTags          []string         `json:"add_tags,omitempty"`
+	RemoveTags       []string         `json:"remove_tags,omitempty"`
+	Journal          *Journal         `json:"journal,omitempty"`
+	Interface        *Interface       `json:"interface,omitempty"`
+	InterfaceFile    string           `json:"interface_file,omitempty"`
+	AllocateIp       *AllocateIp      `json:"allocate_ip,omitempty"`
+	AllocatePrefix   *AllocatePrefix  `json:"allocate_prefix,omitempty"`
+	AllocateVlan     *AllocateVlan    `json:"allocate_vlan,omitempty"`
+	Apply            *Apply           `json:"apply,omitempty"`
+	DryRun           bool             `json:"dry_run,omitempty"`
+	Conflict         string           `json:"conflict,omitempty"`
+	Script           *Script          `json:"script,omitempty"`
+	LocalContext     *LocalContext    `json:"local_context,omitempty"`
+	Acquire          bool             `json:"acquire,omitempty"`
+	Release          bool             `json:"release,omitempty"`
+	Force            bool             `json:"force,omitempty"`
+	Objects          *Objects         `json:"objects,omitempty"`
+	Bulk             *Bulk            `json:"bulk,omitempty"`
+	Lldp             *Lldp            `json:"lldp,omitempty"`
+	ChangelogMessage *string          `json:"changelog_message,omitempty"`
+	RegisterWebhook  *RegisterWebhook `json:"register_webhook,omitempty"`
+}
+
+type Journal struct {
+	Kind        string `json:"kind,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+	CommentFile string `json:"comment_file,omitempty"`
+}
+
+type Interface struct {
+	Enabled      *bool   `json:"enabled,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	Mtu          *int32  `json:"mtu,omitempty"`
+	Mode         *string `json:"mode,omitempty"`
+	UntaggedVlan *int32  `json:"untagged_vlan,omitempty"`
+	TaggedVlans  []int32 `json:"tagged_vlans,omitempty"`
+	MacAddress   *string `json:"mac_address,omitempty"`
+}
+
+type AllocateIp struct {
+	PrefixId     int32         `json:"prefix_id,omitempty"`
+	Prefix       string        `json:"prefix,omitempty"`
+	PrefixFilter *PrefixFilter `json:"prefix_filter,omitempty"`
+	DnsName      string        `json:"dns_name,omitempty"`
+	Description  string        `json:"description,omitempty"`
+	Status       string        `json:"status,omitempty"`
+	Interface    string        `json:"interface,omitempty"`
+	Assign       bool          `json:"assign,omitempty"`
+	Primary      bool          `json:"primary,omitempty"`
+}
+
+type AllocatePrefix struct {
+	ParentPrefixId     int32         `json:"parent_prefix_id,omitempty"`
+	ParentPrefix       string        `json:"parent_prefix,omitempty"`
+	ParentPrefixFilter *PrefixFilter `json:"parent_prefix_filter,omitempty"`
+	PrefixLength       int32         `json:"prefix_length"`
+	Description        string        `json:"description,omitempty"`
+	Status             string        `json:"status,omitempty"`
+}
+
+type AllocateVlan struct {
+	VlanGroupId int32  `json:"vlan_group_id,omitempty"`
+	VlanGroup   string `json:"vlan_group,omitempty"`
+	Name        string `json:"name"`
+	MinVid      int32  `json:"min_vid,omitempty"`
+	MaxVid      int32  `json:"max_vid,omitempty"`
+	Description string `json:"description,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+type LocalContext struct {
+	File             string `json:"file,omitempty"`
+	Data             any    `json:"data,omitempty"`
+	Mode             string `json:"mode,omitempty"`
+	VirtualMachine   string `json:"virtual_machine,omitempty"`
+	VirtualMachineId int32  `json:"virtual_machine_id,omitempty"`
+}
+
+type Script struct {
+	Id       int32          `json:"id,omitempty"`
+	Name     string         `json:"name,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+	DataFile string         `json:"data_file,omitempty"`
+	Commit   *bool          `json:"commit,omitempty"`
+	Timeout  string         `json:"timeout,omitempty"`
+}
+
+type Apply struct {
+	File     string `json:"file,omitempty"`
+	State    *State `json:"state,omitempty"`
+	Prune    bool   `json:"prune,omitempty"`
+	PruneTag string `json:"prune_tag,omitempty"`
+}
+
+type Objects struct {
+	File       string      `json:"file,omitempty"`
+	Spec       *ObjectSpec `json:"spec,omitempty"`
+	MaxDeletes int         `json:"max_deletes,omitempty"`
+	ConfirmTag string      `json:"confirm_tag,omitempty"`
+}
+
+type ObjectSpec struct {
+	Create []StateDevice `json:"create,omitempty"`
+	Delete []ObjectRef   `json:"delete,omitempty"`
+}
+
+// the fields set select a device, an interface of it or an IP address of the interface
+type ObjectRef struct {
+	Site      string `json:"site"`
+	Device    string `json:"device"`
+	Interface string `json:"interface,omitempty"`
+	Address   string `json:"address,omitempty"`
+}
+
+type Bulk struct {
+	File      string       `json:"file,omitempty"`
+	Updates   []BulkUpdate `json:"updates,omitempty"`
+	ChunkSize int          `json:"chunk_size,omitempty"`
+}
+
+type BulkUpdate struct {
+	ObjectType string         `json:"object_type,omitempty"`
+	Id         int32          `json:"id"`
+	Fields     map[string]any `json:"fields"`
+}
+
+type Lldp struct {
+	File         string         `json:"file,omitempty"`
+	Neighbors    []LldpNeighbor `json:"neighbors,omitempty"`
+	CreateCables bool           `json:"create_cables,omitempty"`
+	MarkStatus   string         `json:"mark_status,omitempty"`
+	MarkTag      string         `json:"mark_tag,omitempty"`
+}
+
+type LldpNeighbor struct {
+	Device          string `json:"device,omitempty"`
+	Interface       string `json:"interface"`
+	RemoteDevice    string `json:"remote_device"`
+	RemoteInterface string `json:"remote_interface"`
+}
+
+type RegisterWebhook struct {
+	Name         string   `json:"name"`
+	Url          string   `json:"url,omitempty"`
+	Resource     string   `json:"resource,omitempty"`
+	WebhookToken string   `json:"webhook_token,omitempty"`
+	Secret       string   `json:"secret,omitempty"`
+	EventTypes   []string `json:"event_types,omitempty"`
+}
+
+type State struct {
+	Devices []StateDevice `json:"devices"`
+}
+
+type StateDevice struct {
+	Site         string           `json:"site"`
+	Name         string           `json:"name"`
+	Role         string           `json:"role,omitempty"`
+	DeviceType   string           `json:"device_type,omitempty"`
+	Status       string           `json:"status,omitempty"`
+	Serial       *string          `json:"serial,omitempty"`
+	Description  *string          `json:"description,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	CustomFields map[string]any   `json:"custom_fields,omitempty"`
+	Interfaces   []StateInterface `json:"interfaces,omitempty"`
+}
+
+type StateInterface struct {
+	Name         string           `json:"name"`
+	Type         string           `json:"type,omitempty"`
+	Enabled      *bool            `json:"enabled,omitempty"`
+	MgmtOnly     *bool            `json:"mgmt_only,omitempty"`
+	Description  *string          `json:"description,omitempty"`
+	Mtu          *int32           `json:"mtu,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	CustomFields map[string]any   `json:"custom_fields,omitempty"`
+	IpAddresses  []StateIpAddress `json:"ip_addresses,omitempty"`
+}
+
+type StateIpAddress struct {
+	Address      string         `json:"address"`
+	Status       string         `json:"status,omitempty"`
+	DnsName      *string        `json:"dns_name,omitempty"`
+	Description  *string        `json:"description,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	CustomFields map[string]any `json:"custom_fields,omitempty"`
+}
+
+type PrefixFilter struct {
+	Site   []string `json:"site,omitempty"`
+	Role   []string `json:"role,omitempty"`
+	Tag    []string `json:"tag,omitempty"`
+	Status []string `json:"status,omitempty"`
 }
 
 type Version struct {
@@ -34,6 +247,10 @@ type Version struct {
 	InterfaceType       string `json:"interface_type,omitempty"`
 	InterfaceApiUrl     string `json:"interface_api_url,omitempty"`
 	InterfaceDisplayUrl string `json:"interface_display_url,omitempty"`
+	AllocatedIp         string `json:"allocated_ip,omitempty"`
+	AllocatedPrefix     string `json:"allocated_prefix,omitempty"`
+	AllocatedVlan       string `json:"allocated_vlan,omitempty"`
+	ScriptJob           string `json:"script_job,omitempty"`
 }
 
 type Metadata struct {
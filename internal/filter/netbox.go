@@ -10,6 +10,7 @@ type NetboxObject struct {
 	DeviceStatus     []string        `json:"device_status,omitempty"`
 	ServerInterface  ServerInterface `json:"server_interface,omitempty"`
 	GetConfigContext *bool           `json:"get_config_context,omitempty"`
+	Claimed          *bool           `json:"claimed,omitempty"`
 }
 
 type ServerInterface struct {
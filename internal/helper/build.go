@@ -0,0 +1,79 @@
+package helper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+var (
+	BuildEnvVars = []string{
+		"BUILD_ID",
+		"BUILD_NAME",
+		"BUILD_JOB_NAME",
+		"BUILD_PIPELINE_NAME",
+		"BUILD_PIPELINE_INSTANCE_VARS",
+		"BUILD_TEAM_NAME",
+		"BUILD_CREATED_BY",
+		"ATC_EXTERNAL_URL",
+	}
+)
+
+func BuildMetadata() map[string]string {
+	buildMetadata := make(map[string]string, len(BuildEnvVars)+1)
+	for _, name := range BuildEnvVars {
+		buildMetadata[name] = os.Getenv(name)
+	}
+	buildMetadata["BUILD_URL"] = BuildUrl(buildMetadata)
+	return buildMetadata
+}
+
+// the build url identifies the build, one-off builds fall back to the build id
+func BuildIdentity(buildMetadata map[string]string) string {
+	if buildUrl := BuildUrl(buildMetadata); len(buildUrl) > 0 {
+		return buildUrl
+	}
+	return fmt.Sprintf("build %s", buildMetadata["BUILD_ID"])
+}
+
+// WebhookUrl is the check webhook of a resource in the pipeline of the build
+func WebhookUrl(buildMetadata map[string]string, resource string, webhookToken string) string {
+	if len(buildMetadata["ATC_EXTERNAL_URL"]) == 0 || len(buildMetadata["BUILD_PIPELINE_NAME"]) == 0 || len(resource) == 0 || len(webhookToken) == 0 {
+		return ""
+	}
+	query := instanceVars(buildMetadata)
+	query.Set("webhook_token", webhookToken)
+	return fmt.Sprintf("%s/api/v1/teams/%s/pipelines/%s/resources/%s/check/webhook?%s",
+		buildMetadata["ATC_EXTERNAL_URL"],
+		url.PathEscape(buildMetadata["BUILD_TEAM_NAME"]),
+		url.PathEscape(buildMetadata["BUILD_PIPELINE_NAME"]),
+		url.PathEscape(resource),
+		query.Encode(),
+	)
+}
+
+func BuildUrl(buildMetadata map[string]string) string {
+	if len(buildMetadata["ATC_EXTERNAL_URL"]) == 0 || len(buildMetadata["BUILD_PIPELINE_NAME"]) == 0 || len(buildMetadata["BUILD_JOB_NAME"]) == 0 {
+		return ""
+	}
+	buildUrl := fmt.Sprintf("%s/teams/%s/pipelines/%s/jobs/%s/builds/%s",
+		buildMetadata["ATC_EXTERNAL_URL"],
+		url.PathEscape(buildMetadata["BUILD_TEAM_NAME"]),
+		url.PathEscape(buildMetadata["BUILD_PIPELINE_NAME"]),
+		url.PathEscape(buildMetadata["BUILD_JOB_NAME"]),
+		url.PathEscape(buildMetadata["BUILD_NAME"]),
+	)
+	if query := instanceVars(buildMetadata); len(query) > 0 {
+		buildUrl += "?" + query.Encode()
+	}
+	return buildUrl
+}
+
+// instanced pipelines are identified by their instance vars in addition to the pipeline name
+func instanceVars(buildMetadata map[string]string) url.Values {
+	query := url.Values{}
+	if vars := buildMetadata["BUILD_PIPELINE_INSTANCE_VARS"]; len(vars) > 0 {
+		query.Set("vars", vars)
+	}
+	return query
+}
@@ -0,0 +1,63 @@
+package helper
+
+import (
+	"testing"
+)
+
+func TestBuildUrl(t *testing.T) {
+	buildMetadata := map[string]string{
+		"ATC_EXTERNAL_URL":    "https://concourse.example.local",
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "provisioning",
+		"BUILD_JOB_NAME":      "deploy servers",
+		"BUILD_NAME":          "42.1",
+	}
+	instanced := map[string]string{"BUILD_PIPELINE_INSTANCE_VARS": `{"dc":"a"}`}
+	for name, value := range buildMetadata {
+		instanced[name] = value
+	}
+
+	tests := []struct {
+		name          string
+		buildMetadata map[string]string
+		expected      string
+	}{
+		{"escaped", buildMetadata, "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/deploy%20servers/builds/42.1"},
+		{"instanceVars", instanced, "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/deploy%20servers/builds/42.1?vars=%7B%22dc%22%3A%22a%22%7D"},
+		{"oneOffBuild", map[string]string{"ATC_EXTERNAL_URL": "https://concourse.example.local", "BUILD_ID": "1234"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := BuildUrl(test.buildMetadata); result != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestWebhookUrl(t *testing.T) {
+	buildMetadata := map[string]string{
+		"ATC_EXTERNAL_URL":    "https://concourse.example.local",
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "provisioning",
+	}
+
+	tests := []struct {
+		name         string
+		instanceVars string
+		expected     string
+	}{
+		{"pipeline", "", "https://concourse.example.local/api/v1/teams/main/pipelines/provisioning/resources/example.netbox/check/webhook?webhook_token=s%26cret"},
+		{"instanceVars", `{"dc":"a"}`, "https://concourse.example.local/api/v1/teams/main/pipelines/provisioning/resources/example.netbox/check/webhook?vars=%7B%22dc%22%3A%22a%22%7D&webhook_token=s%26cret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buildMetadata["BUILD_PIPELINE_INSTANCE_VARS"] = test.instanceVars
+			if result := WebhookUrl(buildMetadata, "example.netbox", "s&cret"); result != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+func ReadDataFile(path string) (map[string]any, error) {
+	var (
+		data map[string]any
+	)
+
+	if err := DecodeDataFile(path, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// YAML is a superset of JSON, so both formats are decoded by the YAML parser
+func DecodeDataFile(path string, data any) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(content, data); err != nil {
+		return fmt.Errorf("failed to decode JSON or YAML from %s: %w", path, err)
+	}
+	return nil
+}
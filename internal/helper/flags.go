@@ -16,7 +16,7 @@ var (
 )
 
 func AddFlags() CmdLineFlags {
-	flag.StringVar(&flags.Command, "c", "", "[check|in|out] command to execute")
+	flag.StringVar(&flags.Command, "c", "", "[check|in|out|relay|watch] command to execute")
 	flag.BoolVar(&flags.Versioninfo, "v", false, "return program version")
 	flag.BoolVar(&flags.Buildinfo, "b", false, "return build information")
 	flag.BoolVar(&flags.Help, "h", false, "return this help message")
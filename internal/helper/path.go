@@ -0,0 +1,29 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func ResolvePath(basePath string, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(basePath, path)
+}
+
+func ValidateDirectory(path string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("path argument is required")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to access %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
@@ -6,8 +6,6 @@ import (
 )
 
 var (
-	ConcourseOutputPath   string = "/tmp/build/get"
-	ConcourseInputPath    string = "/tmp/build/put"
 	ConcourseSourceConfig string = `
 		{
 			"source": {
@@ -85,6 +83,24 @@ var (
 			}
 		}
 	`
+	ConcourseVersionInvalidOnMissing string = `
+		{
+			"source": {
+				"url": "https://netbox.example.local",
+				"token": "your-api-token"
+			},
+			"version": {
+				"id": "123",
+				"last_updated": "2025-06-23T15:16:56Z",
+				"object_type": "devices",
+				"device_name": "server01",
+				"device_role": "server"
+			},
+			"params": {
+				"on_missing": "ignore"
+			}
+		}
+	`
 	NetBoxConfigContextData = map[string]any{
 		"management_ip": "192.168.1.100",
 		"location":      "rack-1",
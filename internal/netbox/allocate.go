@@ -0,0 +1,373 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func AllocateIp(input concourse.Input, ctx context.Context) (concourse.Version, error) {
+	version := input.Version
+	params := input.Params.AllocateIp
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	request, err := createIpAddressRequest(*params)
+	if err != nil {
+		return version, err
+	}
+
+	if params.Assign || params.Primary {
+		interfaceId, err := getAssignedInterfaceId(client, version, params.Interface, ctx)
+		if err != nil {
+			return version, err
+		}
+		request.AssignedObjectType.Set(netbox.PtrString("dcim.interface"))
+		request.AssignedObjectId.Set(netbox.PtrInt64(int64(interfaceId)))
+	}
+
+	prefixIds, err := getPrefixIds(client, params.PrefixId, params.Prefix, params.PrefixFilter, ctx)
+	if err != nil {
+		return version, err
+	}
+
+	ipAddress, err := allocateIpFromPrefixes(client, prefixIds, request, input.Params.DryRun, ctx)
+	if err != nil {
+		return version, err
+	}
+	if !input.Params.DryRun {
+		version.AllocatedIp = ipAddress.Address
+	}
+
+	if params.Primary {
+		deviceId, err := getDeviceId(version)
+		if err != nil {
+			return version, err
+		}
+
+		primaryField, err := primaryIpField(ipAddress.Address)
+		if err != nil {
+			return version, err
+		}
+
+		var ipAddressId any = ipAddress.Id
+		if input.Params.DryRun {
+			ipAddressId = placeholderId("IP address " + ipAddress.Address)
+		}
+		deviceRequest := netbox.PatchedWritableDeviceWithConfigContextRequest{
+			AdditionalProperties: map[string]any{primaryField: ipAddressId},
+		}
+		request := PlannedRequest{Method: http.MethodPatch, Path: objectPath("dcim/devices", deviceId), Body: deviceRequest}
+		err = write(client, input.Params.DryRun, request, func() error {
+			device, _, err := client.DcimAPI.DcimDevicesPartialUpdate(ctx, deviceId).PatchedWritableDeviceWithConfigContextRequest(deviceRequest).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimDevicesPartialUpdate request: %w", err)
+			}
+			version = updatedVersion(version, device.LastUpdated.Get())
+			return nil
+		}, ctx)
+	}
+	return version, err
+}
+
+func AllocatePrefix(input concourse.Input, ctx context.Context) (concourse.Version, error) {
+	var (
+		allocationErrors []error
+	)
+
+	version := input.Version
+	params := input.Params.AllocatePrefix
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	request, err := createPrefixRequest(*params)
+	if err != nil {
+		return version, err
+	}
+
+	prefixIds, err := getPrefixIds(client, params.ParentPrefixId, params.ParentPrefix, params.ParentPrefixFilter, ctx)
+	if err != nil {
+		return version, err
+	}
+
+	// the prefix chosen by NetBox is unknown without the allocation
+	if input.Params.DryRun {
+		return version, write(client, true, PlannedRequest{Method: http.MethodPost, Path: objectPath("ipam/prefixes", prefixIds[0]) + "available-prefixes/", Body: []netbox.PrefixRequest{request}}, nil, ctx)
+	}
+
+	// try the parent prefixes in order, as a prefix matching the filter might be exhausted
+	for _, prefixId := range prefixIds {
+		var prefixList []netbox.Prefix
+		plannedRequest := PlannedRequest{Method: http.MethodPost, Path: objectPath("ipam/prefixes", prefixId) + "available-prefixes/", Body: []netbox.PrefixRequest{request}}
+		err := write(client, false, plannedRequest, func() error {
+			var err error
+			prefixList, _, err = client.IpamAPI.IpamPrefixesAvailablePrefixesCreate(ctx, prefixId).PrefixRequest([]netbox.PrefixRequest{request}).Execute()
+			return err
+		}, ctx)
+		if err != nil {
+			allocationErrors = append(allocationErrors, fmt.Errorf("prefix %d: %w", prefixId, err))
+			continue
+		}
+		if len(prefixList) == 1 {
+			version.AllocatedPrefix = prefixList[0].Prefix
+			return version, nil
+		}
+		allocationErrors = append(allocationErrors, fmt.Errorf("prefix %d: expected one prefix, got %d", prefixId, len(prefixList)))
+	}
+	return version, fmt.Errorf("error during IpamPrefixesAvailablePrefixesCreate request: %v", allocationErrors)
+}
+
+func AllocateVlan(input concourse.Input, ctx context.Context) (concourse.Version, error) {
+	version := input.Version
+	params := input.Params.AllocateVlan
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	vlanGroupId, err := getVlanGroupId(client, *params, ctx)
+	if err != nil {
+		return version, err
+	}
+
+	availableVlans, _, err := client.IpamAPI.IpamVlanGroupsAvailableVlansList(ctx, vlanGroupId).Execute()
+	if err != nil {
+		return version, fmt.Errorf("error during IpamVlanGroupsAvailableVlansList query: %w", err)
+	}
+
+	availableVids := make([]int32, 0, len(availableVlans))
+	for _, availableVlan := range availableVlans {
+		availableVids = append(availableVids, availableVlan.Vid)
+	}
+	vid, err := selectVid(availableVids, params.MinVid, params.MaxVid)
+	if err != nil {
+		return version, fmt.Errorf("VLAN group %d: %w", vlanGroupId, err)
+	}
+
+	request, err := createVlanRequest(*params, vlanGroupId, vid)
+	if err != nil {
+		return version, err
+	}
+
+	// the VLAN is created with the chosen id, as available-vlans/ ignores it and picks the lowest available id of the group
+	plannedRequest := PlannedRequest{Method: http.MethodPost, Path: listPath("ipam/vlans"), Body: request}
+	err = write(client, input.Params.DryRun, plannedRequest, func() error {
+		vlan, _, err := client.IpamAPI.IpamVlansCreate(ctx).WritableVLANRequest(request).Execute()
+		if err != nil {
+			return fmt.Errorf("error during IpamVlansCreate request: %w", err)
+		}
+		if vlan.Vid != vid {
+			return fmt.Errorf("VLAN group %d: expected VLAN id %d, got %d", vlanGroupId, vid, vlan.Vid)
+		}
+		version.AllocatedVlan = fmt.Sprintf("%d", vlan.Vid)
+		return nil
+	}, ctx)
+	return version, err
+}
+
+func createPrefixRequest(params concourse.AllocatePrefix) (netbox.PrefixRequest, error) {
+	if params.PrefixLength <= 0 {
+		return netbox.PrefixRequest{}, fmt.Errorf("params.allocate_prefix.prefix_length is required")
+	}
+
+	// the prefix is chosen by NetBox from the available prefixes of the parent
+	request := netbox.NewPrefixRequest("")
+	request.AdditionalProperties = map[string]any{"prefix_length": params.PrefixLength}
+	if len(params.Status) > 0 {
+		status, err := netbox.NewPrefixStatusValueFromValue(params.Status)
+		if err != nil {
+			return netbox.PrefixRequest{}, fmt.Errorf("invalid params.allocate_prefix.status: %w", err)
+		}
+		request.Status = status
+	}
+	if len(params.Description) > 0 {
+		request.Description = &params.Description
+	}
+	return *request, nil
+}
+
+func createVlanRequest(params concourse.AllocateVlan, vlanGroupId int32, vid int32) (netbox.WritableVLANRequest, error) {
+	if len(params.Name) == 0 {
+		return netbox.WritableVLANRequest{}, fmt.Errorf("params.allocate_vlan.name is required")
+	}
+
+	request := netbox.NewWritableVLANRequest(vid, params.Name)
+	// the nested group request requires name and slug, the id is sufficient for NetBox
+	request.AdditionalProperties = map[string]any{"group": vlanGroupId}
+	if len(params.Status) > 0 {
+		status, err := netbox.NewPatchedWritableVLANRequestStatusFromValue(params.Status)
+		if err != nil {
+			return netbox.WritableVLANRequest{}, fmt.Errorf("invalid params.allocate_vlan.status: %w", err)
+		}
+		request.Status = status
+	}
+	if len(params.Description) > 0 {
+		request.Description = &params.Description
+	}
+	return *request, nil
+}
+
+func getVlanGroupId(client *netbox.APIClient, params concourse.AllocateVlan, ctx context.Context) (int32, error) {
+	if params.VlanGroupId > 0 {
+		return params.VlanGroupId, nil
+	}
+	if len(params.VlanGroup) == 0 {
+		return 0, fmt.Errorf("one of vlan_group_id or vlan_group is required to allocate a VLAN")
+	}
+
+	vlanGroupList, _, err := client.IpamAPI.IpamVlanGroupsList(ctx).Slug([]string{params.VlanGroup}).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("error during IpamVlanGroupsList query: %w", err)
+	}
+	if len(vlanGroupList.Results) != 1 {
+		return 0, fmt.Errorf("expected one VLAN group %s, found %d", params.VlanGroup, len(vlanGroupList.Results))
+	}
+	return vlanGroupList.Results[0].Id, nil
+}
+
+func selectVid(availableVids []int32, minVid int32, maxVid int32) (int32, error) {
+	for _, vid := range availableVids {
+		if (minVid > 0 && vid < minVid) || (maxVid > 0 && vid > maxVid) {
+			continue
+		}
+		return vid, nil
+	}
+	return 0, fmt.Errorf("no VLAN id available between %d and %d", minVid, maxVid)
+}
+
+func createIpAddressRequest(params concourse.AllocateIp) (netbox.IPAddressRequest, error) {
+	// the address is chosen by NetBox from the available IPs of the prefix
+	request := netbox.NewIPAddressRequest("")
+	if len(params.Status) > 0 {
+		status, err := netbox.NewIPAddressStatusValueFromValue(params.Status)
+		if err != nil {
+			return netbox.IPAddressRequest{}, fmt.Errorf("invalid params.allocate_ip.status: %w", err)
+		}
+		request.Status = status
+	}
+	if len(params.DnsName) > 0 {
+		request.DnsName = &params.DnsName
+	}
+	if len(params.Description) > 0 {
+		request.Description = &params.Description
+	}
+	return *request, nil
+}
+
+func getAssignedInterfaceId(client *netbox.APIClient, version concourse.Version, interfaceName string, ctx context.Context) (int32, error) {
+	if len(interfaceName) == 0 {
+		if version.ObjectType != "interfaces" {
+			return 0, fmt.Errorf("an interface name is required to assign an IP address to a device version")
+		}
+		return getObjectId(version)
+	}
+
+	deviceId, err := getDeviceId(version)
+	if err != nil {
+		return 0, err
+	}
+
+	interfaceList, _, err := client.DcimAPI.DcimInterfacesList(ctx).DeviceId([]int32{deviceId}).Name([]string{interfaceName}).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("error during DcimInterfacesList query: %w", err)
+	}
+	if len(interfaceList.Results) != 1 {
+		return 0, fmt.Errorf("expected one interface %s on device %d, found %d", interfaceName, deviceId, len(interfaceList.Results))
+	}
+	return interfaceList.Results[0].Id, nil
+}
+
+func getPrefixIds(client *netbox.APIClient, prefixId int32, prefix string, prefixFilter *concourse.PrefixFilter, ctx context.Context) ([]int32, error) {
+	if prefixId > 0 {
+		return []int32{prefixId}, nil
+	}
+
+	query := client.IpamAPI.IpamPrefixesList(ctx)
+	switch {
+	case len(prefix) > 0:
+		query = query.Prefix([]string{prefix})
+	case prefixFilter != nil:
+		query = createPrefixQuery(query, *prefixFilter)
+	default:
+		return nil, fmt.Errorf("one of prefix id, prefix or prefix filter is required for the allocation")
+	}
+
+	prefixList, _, err := query.Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error during IpamPrefixesList query: %w", err)
+	}
+	if len(prefixList.Results) == 0 {
+		return nil, fmt.Errorf("no prefix found to allocate from")
+	}
+
+	prefixIds := make([]int32, 0, len(prefixList.Results))
+	for _, prefix := range prefixList.Results {
+		prefixIds = append(prefixIds, prefix.Id)
+	}
+	return prefixIds, nil
+}
+
+func createPrefixQuery(query netbox.ApiIpamPrefixesListRequest, prefixFilter concourse.PrefixFilter) netbox.ApiIpamPrefixesListRequest {
+	if len(prefixFilter.Site) > 0 {
+		query = query.Site(prefixFilter.Site)
+	}
+	if len(prefixFilter.Role) > 0 {
+		query = query.Role(prefixFilter.Role)
+	}
+	if len(prefixFilter.Tag) > 0 {
+		query = query.Tag(prefixFilter.Tag)
+	}
+	if len(prefixFilter.Status) > 0 {
+		query = query.Status(prefixFilter.Status)
+	}
+	return query
+}
+
+func allocateIpFromPrefixes(client *netbox.APIClient, prefixIds []int32, request netbox.IPAddressRequest, dryRun bool, ctx context.Context) (netbox.IPAddress, error) {
+	var (
+		allocationErrors []error
+	)
+
+	// try the prefixes in order, as a prefix matching the filter might be exhausted
+	for _, prefixId := range prefixIds {
+		plannedRequest := PlannedRequest{Method: http.MethodPost, Path: objectPath("ipam/prefixes", prefixId) + "available-ips/", Body: []netbox.IPAddressRequest{request}}
+		if dryRun {
+			availableIps, _, err := client.IpamAPI.IpamPrefixesAvailableIpsList(ctx, prefixId).Execute()
+			if err != nil {
+				allocationErrors = append(allocationErrors, fmt.Errorf("prefix %d: %w", prefixId, err))
+				continue
+			}
+			if len(availableIps) == 0 {
+				allocationErrors = append(allocationErrors, fmt.Errorf("prefix %d: no IP address available", prefixId))
+				continue
+			}
+			return netbox.IPAddress{Address: availableIps[0].Address}, write(client, true, plannedRequest, nil, ctx)
+		}
+
+		var ipAddressList []netbox.IPAddress
+		err := write(client, false, plannedRequest, func() error {
+			var err error
+			ipAddressList, _, err = client.IpamAPI.IpamPrefixesAvailableIpsCreate(ctx, prefixId).IPAddressRequest([]netbox.IPAddressRequest{request}).Execute()
+			return err
+		}, ctx)
+		if err != nil {
+			allocationErrors = append(allocationErrors, fmt.Errorf("prefix %d: %w", prefixId, err))
+			continue
+		}
+		if len(ipAddressList) == 1 {
+			return ipAddressList[0], nil
+		}
+		allocationErrors = append(allocationErrors, fmt.Errorf("prefix %d: expected one IP address, got %d", prefixId, len(ipAddressList)))
+	}
+	return netbox.IPAddress{}, fmt.Errorf("error during IpamPrefixesAvailableIpsCreate request: %v", allocationErrors)
+}
+
+func primaryIpField(address string) (string, error) {
+	prefix, err := netip.ParsePrefix(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid IP address %s: %w", address, err)
+	}
+	if prefix.Addr().Is4() {
+		return "primary_ip4", nil
+	}
+	return "primary_ip6", nil
+}
@@ -0,0 +1,331 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestCreateIpAddressRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  concourse.AllocateIp
+		wantErr bool
+	}{
+		{"noAttributes", concourse.AllocateIp{PrefixId: 12}, false},
+		{"allAttributes", concourse.AllocateIp{PrefixId: 12, DnsName: "server01.example.local", Description: "provisioning", Status: "reserved"}, false},
+		{"invalidStatus", concourse.AllocateIp{PrefixId: 12, Status: "allocated"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := createIpAddressRequest(test.params)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createIpAddressRequest() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if len(test.params.Status) > 0 && (request.Status == nil || string(*request.Status) != test.params.Status) {
+				t.Errorf("expected status '%s', got %v", test.params.Status, request.Status)
+			}
+			if len(test.params.DnsName) > 0 && request.GetDnsName() != test.params.DnsName {
+				t.Errorf("expected dns_name '%s', got '%s'", test.params.DnsName, request.GetDnsName())
+			}
+			if len(test.params.Description) > 0 && request.GetDescription() != test.params.Description {
+				t.Errorf("expected description '%s', got '%s'", test.params.Description, request.GetDescription())
+			}
+		})
+	}
+}
+
+func TestPrimaryIpField(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		expected string
+		wantErr  bool
+	}{
+		{"ipv4", "10.0.0.5/24", "primary_ip4", false},
+		{"ipv6", "2001:db8::5/64", "primary_ip6", false},
+		{"missingPrefixLength", "10.0.0.5", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			field, err := primaryIpField(test.address)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("primaryIpField() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if field != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, field)
+			}
+		})
+	}
+}
+
+func TestCreatePrefixRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   concourse.AllocatePrefix
+		expected string
+		wantErr  bool
+	}{
+		{"prefixLength", concourse.AllocatePrefix{ParentPrefixId: 1, PrefixLength: 26}, `{"prefix":"","prefix_length":26}`, false},
+		{"allAttributes", concourse.AllocatePrefix{ParentPrefixId: 1, PrefixLength: 28, Status: "reserved", Description: "tenant-a"}, `{"description":"tenant-a","prefix":"","prefix_length":28,"status":"reserved"}`, false},
+		{"missingPrefixLength", concourse.AllocatePrefix{ParentPrefixId: 1}, "", true},
+		{"invalidStatus", concourse.AllocatePrefix{ParentPrefixId: 1, PrefixLength: 26, Status: "used"}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := createPrefixRequest(test.params)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createPrefixRequest() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			requestBytes, err := json.Marshal(request)
+			if err != nil {
+				t.Fatalf("failed to encode request: %v", err)
+			}
+			if string(requestBytes) != test.expected {
+				t.Errorf("expected request %s, got %s", test.expected, string(requestBytes))
+			}
+		})
+	}
+}
+
+func TestCreateVlanRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   concourse.AllocateVlan
+		expected string
+		wantErr  bool
+	}{
+		{"nameOnly", concourse.AllocateVlan{VlanGroupId: 1, Name: "tenant-a"}, `{"group":1,"name":"tenant-a","vid":101}`, false},
+		{"allAttributes", concourse.AllocateVlan{VlanGroupId: 1, Name: "tenant-a", Status: "reserved", Description: "tenant a"}, `{"description":"tenant a","group":1,"name":"tenant-a","status":"reserved","vid":101}`, false},
+		{"deprecatedStatus", concourse.AllocateVlan{VlanGroupId: 1, Name: "tenant-a", Status: "deprecated"}, `{"group":1,"name":"tenant-a","status":"deprecated","vid":101}`, false},
+		{"missingName", concourse.AllocateVlan{VlanGroupId: 1}, "", true},
+		{"invalidStatus", concourse.AllocateVlan{VlanGroupId: 1, Name: "tenant-a", Status: "used"}, "", true},
+		{"prefixStatus", concourse.AllocateVlan{VlanGroupId: 1, Name: "tenant-a", Status: "container"}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := createVlanRequest(test.params, 1, 101)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createVlanRequest() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			requestBytes, err := json.Marshal(request)
+			if err != nil {
+				t.Fatalf("failed to marshal request: %v", err)
+			}
+			if string(requestBytes) != test.expected {
+				t.Errorf("expected request %s, got %s", test.expected, string(requestBytes))
+			}
+		})
+	}
+}
+
+func TestAllocateVlan(t *testing.T) {
+	tests := []struct {
+		name        string
+		minVid      int32
+		maxVid      int32
+		createdVid  int32
+		expectedVid int32
+		expected    string
+		wantErr     bool
+	}{
+		{"withinRange", 100, 200, 0, 150, "150", false},
+		{"lowestAvailable", 0, 0, 0, 2, "2", false},
+		{"createdOutsideRange", 100, 200, 2, 150, "", true},
+		{"noneInRange", 400, 500, 0, 0, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var created map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/api/ipam/vlan-groups/1/available-vlans/":
+					_, _ = w.Write([]byte(`[{"vid":2},{"vid":150},{"vid":151}]`))
+				case r.Method == http.MethodPost && r.URL.Path == "/api/ipam/vlans/":
+					_ = json.NewDecoder(r.Body).Decode(&created)
+					vid := created["vid"]
+					if test.createdVid > 0 {
+						vid = test.createdVid
+					}
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(map[string]any{"id": 7, "url": "/api/ipam/vlans/7/", "display": "tenant-a", "vid": vid, "name": created["name"]})
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			input := concourse.Input{
+				Source: concourse.Source{Url: server.URL},
+				Params: concourse.Params{AllocateVlan: &concourse.AllocateVlan{VlanGroupId: 1, Name: "tenant-a", MinVid: test.minVid, MaxVid: test.maxVid}},
+			}
+			version, err := AllocateVlan(input, context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("AllocateVlan() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if version.AllocatedVlan != test.expected {
+				t.Errorf("expected allocated VLAN %q, got %q", test.expected, version.AllocatedVlan)
+			}
+			if test.expectedVid > 0 && (toFloat(created["vid"]) != float64(test.expectedVid) || toFloat(created["group"]) != 1) {
+				t.Errorf("expected VLAN %d in group 1 to be created, got %v", test.expectedVid, created)
+			}
+		})
+	}
+}
+
+func TestSelectVid(t *testing.T) {
+	availableVids := []int32{2, 3, 150, 151, 300}
+
+	tests := []struct {
+		name     string
+		minVid   int32
+		maxVid   int32
+		expected int32
+		wantErr  bool
+	}{
+		{"noConstraints", 0, 0, 2, false},
+		{"minVid", 100, 0, 150, false},
+		{"range", 100, 199, 150, false},
+		{"maxVid", 0, 2, 2, false},
+		{"noneInRange", 200, 299, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vid, err := selectVid(availableVids, test.minVid, test.maxVid)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("selectVid() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if vid != test.expected {
+				t.Errorf("expected VLAN id %d, got %d", test.expected, vid)
+			}
+		})
+	}
+}
+
+func TestAllocateChangelogMessage(t *testing.T) {
+	family := map[string]any{"value": 4, "label": "IPv4"}
+
+	tests := []struct {
+		name     string
+		path     string
+		response any
+		allocate func(input concourse.Input) (concourse.Version, error)
+		expected string
+	}{
+		{"prefix", "/api/ipam/prefixes/12/available-prefixes/",
+			[]any{map[string]any{"id": 9, "url": "/api/ipam/prefixes/9/", "display": "10.1.0.0/28", "family": family, "prefix": "10.1.0.0/28", "children": 0, "_depth": 1}},
+			func(input concourse.Input) (concourse.Version, error) {
+				input.Params.AllocatePrefix = &concourse.AllocatePrefix{ParentPrefixId: 12, PrefixLength: 28}
+				return AllocatePrefix(input, context.Background())
+			}, "10.1.0.0/28"},
+		{"ip", "/api/ipam/prefixes/12/available-ips/",
+			[]any{map[string]any{"id": 5, "url": "/api/ipam/ip-addresses/5/", "display": "10.0.0.5/24", "family": family, "address": "10.0.0.5/24", "nat_outside": []any{}}},
+			func(input concourse.Input) (concourse.Version, error) {
+				input.Params.AllocateIp = &concourse.AllocateIp{PrefixId: 12}
+				return AllocateIp(input, context.Background())
+			}, "10.0.0.5/24"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received []map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != test.path {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_ = json.NewDecoder(r.Body).Decode(&received)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(test.response)
+			}))
+			defer server.Close()
+
+			SetChangelogMessage("deploy #42")
+			defer SetChangelogMessage("")
+			version, err := test.allocate(concourse.Input{Source: concourse.Source{Url: server.URL}})
+			if err != nil {
+				t.Fatalf("allocation error: '%v'", err)
+			}
+			if version.AllocatedIp+version.AllocatedPrefix != test.expected {
+				t.Errorf("expected allocation %s, got %+v", test.expected, version)
+			}
+			if len(received) != 1 || received[0]["changelog_message"] != "deploy #42" {
+				t.Errorf("expected changelog_message in allocation request, got %v", received)
+			}
+		})
+	}
+}
+
+func TestAllocateIpPrimary(t *testing.T) {
+	var (
+		allocated   []map[string]any
+		devicePatch map[string]any
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/dcim/interfaces/":
+			if r.URL.Query().Get("device_id") != "1" || r.URL.Query().Get("name") != "eth0" {
+				t.Errorf("unexpected interface query %s", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"count": 1, "results": []any{testInterface(10, "eth0", "2025-01-01T00:00:00Z")}})
+		case "POST /api/ipam/prefixes/12/available-ips/":
+			_ = json.NewDecoder(r.Body).Decode(&allocated)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode([]any{map[string]any{"id": 5, "url": "/api/ipam/ip-addresses/5/", "display": "10.0.0.5/24",
+				"family": map[string]any{"value": 4, "label": "IPv4"}, "address": "10.0.0.5/24", "nat_outside": []any{}}})
+		case "PATCH /api/dcim/devices/1/":
+			_ = json.NewDecoder(r.Body).Decode(&devicePatch)
+			device := testDevice(1, "server-1", map[string]any{})
+			device["last_updated"] = "2025-02-01T10:00:00Z"
+			_ = json.NewEncoder(w).Encode(device)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	input := concourse.Input{
+		Source:  concourse.Source{Url: server.URL},
+		Version: concourse.Version{Id: "1", LastUpdated: "2025-01-01T00:00:00Z", ObjectType: "devices"},
+		Params:  concourse.Params{AllocateIp: &concourse.AllocateIp{PrefixId: 12, Interface: "eth0", Primary: true, DnsName: "server-1.example.local"}},
+	}
+	version, err := AllocateIp(input, context.Background())
+	if err != nil {
+		t.Fatalf("AllocateIp() error: '%v'", err)
+	}
+	if len(allocated) != 1 || allocated[0]["assigned_object_type"] != "dcim.interface" || allocated[0]["assigned_object_id"] != 10.0 || allocated[0]["dns_name"] != "server-1.example.local" {
+		t.Errorf("expected IP address assigned to interface 10, got %v", allocated)
+	}
+	if !reflect.DeepEqual(devicePatch, map[string]any{"primary_ip4": 5.0}) {
+		t.Errorf("expected primary_ip4 patch of the device, got %v", devicePatch)
+	}
+	if version.AllocatedIp != "10.0.0.5/24" || version.LastUpdated != "2025-02-01T10:00:00Z" {
+		t.Errorf("expected allocated IP and last_updated of the device patch, got %+v", version)
+	}
+}
@@ -0,0 +1,678 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+	"github.com/sapcc/concourse-netbox-resource/internal/filter"
+)
+
+const (
+	applyCreate string = "create"
+	applyUpdate string = "update"
+	applyDelete string = "delete"
+)
+
+var (
+	// created objects reference their parent, which may be created in the same run
+	parentFields = map[string]string{
+		"interfaces":   "device",
+		"ip-addresses": "assigned_object_id",
+	}
+	applyEndpoints = map[string]string{
+		"devices":      "dcim/devices",
+		"interfaces":   "dcim/interfaces",
+		"ip-addresses": "ipam/ip-addresses",
+	}
+)
+
+type PlannedChange struct {
+	Action     string         `json:"action"`
+	ObjectType string         `json:"object_type"`
+	Key        string         `json:"key"`
+	Id         int32          `json:"id,omitempty"`
+	Parent     string         `json:"parent,omitempty"`
+	Fields     map[string]any `json:"fields,omitempty"`
+}
+
+type currentObject struct {
+	Id       int32
+	Fields   map[string]any
+	Children map[string]currentObject
+}
+
+type applyReferences struct {
+	Sites       map[string]int32
+	Roles       map[string]int32
+	DeviceTypes map[string]int32
+	Tags        map[string]int32
+}
+
+type stateField struct {
+	name    string
+	desired any
+	current any
+	value   any
+}
+
+func Apply(input concourse.Input, ctx context.Context) ([]PlannedChange, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	apply := input.Params.Apply
+	if apply == nil || apply.State == nil {
+		return nil, fmt.Errorf("params.apply requires a desired state in file or state")
+	}
+	if err := validateState(*apply.State); err != nil {
+		return nil, err
+	}
+
+	references, err := loadApplyReferences(client, *apply.State, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := loadCurrentState(client, *apply, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := planState(*apply.State, current, references, apply.Prune)
+	if err != nil {
+		return nil, err
+	}
+
+	return executePlan(client, plan, currentIds(current), input.Params.DryRun, ctx)
+}
+
+// executePlan returns the changes executed before a failure together with the error, as they are not rolled back
+func executePlan(client *netbox.APIClient, plan []PlannedChange, ids map[string]int32, dryRun bool, ctx context.Context) ([]PlannedChange, error) {
+	for i, change := range plan {
+		if err := executeChange(client, change, ids, dryRun, ctx); err != nil {
+			return plan[:i], fmt.Errorf("failed to %s %s %s: %w", change.Action, change.ObjectType, change.Key, err)
+		}
+	}
+	return plan, nil
+}
+
+func (change PlannedChange) String() string {
+	if change.Action == applyDelete || len(change.Fields) == 0 {
+		return fmt.Sprintf("%s %s %s", change.Action, change.ObjectType, change.Key)
+	}
+	fields := slices.Sorted(maps.Keys(change.Fields))
+	return fmt.Sprintf("%s %s %s: %s", change.Action, change.ObjectType, change.Key, strings.Join(fields, ", "))
+}
+
+func validateState(state concourse.State) error {
+	keys := make([]string, 0, len(state.Devices))
+	for _, device := range state.Devices {
+		if len(device.Site) == 0 || len(device.Name) == 0 {
+			return fmt.Errorf("devices in the desired state require site and name")
+		}
+		key := deviceKey(device.Site, device.Name)
+		keys = append(keys, key)
+		for _, iface := range device.Interfaces {
+			if len(iface.Name) == 0 {
+				return fmt.Errorf("interfaces of device %s require a name", key)
+			}
+			interfaceKey := childKey(key, iface.Name)
+			keys = append(keys, interfaceKey)
+			for _, ipAddress := range iface.IpAddresses {
+				if len(ipAddress.Address) == 0 {
+					return fmt.Errorf("IP addresses of interface %s require an address", interfaceKey)
+				}
+				keys = append(keys, childKey(interfaceKey, ipAddress.Address))
+			}
+		}
+	}
+
+	slices.Sort(keys)
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			return fmt.Errorf("%s is declared more than once in the desired state", keys[i])
+		}
+	}
+	return nil
+}
+
+func planState(state concourse.State, current map[string]currentObject, references applyReferences, prune bool) ([]PlannedChange, error) {
+	var (
+		plan             []PlannedChange
+		deviceDeletes    []PlannedChange
+		interfaceDeletes []PlannedChange
+		ipAddressDeletes []PlannedChange
+	)
+
+	for _, device := range state.Devices {
+		key := deviceKey(device.Site, device.Name)
+		currentDevice, exists := current[key]
+
+		fields, err := deviceFields(device, currentDevice.Fields, references)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device %s: %w", key, err)
+		}
+		if !exists && (len(device.Role) == 0 || len(device.DeviceType) == 0) {
+			return nil, fmt.Errorf("device %s does not exist, creating it requires role and device_type", key)
+		}
+		createFields := map[string]any{"name": device.Name, "site": references.Sites[device.Site]}
+		plan = appendChange(plan, planObject("devices", key, "", currentDevice, exists, fields, createFields))
+
+		for _, iface := range device.Interfaces {
+			interfaceKey := childKey(key, iface.Name)
+			currentInterface, interfaceExists := currentDevice.Children[iface.Name]
+
+			fields, err := interfaceFields(iface, currentInterface.Fields, references)
+			if err != nil {
+				return nil, fmt.Errorf("invalid interface %s: %w", interfaceKey, err)
+			}
+			if !interfaceExists && len(iface.Type) == 0 {
+				return nil, fmt.Errorf("interface %s does not exist, creating it requires type", interfaceKey)
+			}
+			createFields := map[string]any{"name": iface.Name}
+			plan = appendChange(plan, planObject("interfaces", interfaceKey, key, currentInterface, interfaceExists, fields, createFields))
+
+			for _, ipAddress := range iface.IpAddresses {
+				ipAddressKey := childKey(interfaceKey, ipAddress.Address)
+				currentIpAddress, ipAddressExists := currentInterface.Children[ipAddress.Address]
+
+				fields, err := ipAddressFields(ipAddress, currentIpAddress.Fields, references)
+				if err != nil {
+					return nil, fmt.Errorf("invalid IP address %s: %w", ipAddressKey, err)
+				}
+				createFields := map[string]any{"address": ipAddress.Address, "assigned_object_type": "dcim.interface"}
+				plan = appendChange(plan, planObject("ip-addresses", ipAddressKey, interfaceKey, currentIpAddress, ipAddressExists, fields, createFields))
+			}
+
+			// only IP addresses of interfaces declaring ip_addresses are owned by the desired state
+			if prune && iface.IpAddresses != nil {
+				declared := make([]string, 0, len(iface.IpAddresses))
+				for _, ipAddress := range iface.IpAddresses {
+					declared = append(declared, ipAddress.Address)
+				}
+				ipAddressDeletes = append(ipAddressDeletes, planDeletes("ip-addresses", interfaceKey, currentInterface.Children, declared)...)
+			}
+		}
+
+		if prune && device.Interfaces != nil {
+			declared := make([]string, 0, len(device.Interfaces))
+			for _, iface := range device.Interfaces {
+				declared = append(declared, iface.Name)
+			}
+			interfaceDeletes = append(interfaceDeletes, planDeletes("interfaces", key, currentDevice.Children, declared)...)
+		}
+	}
+
+	if prune {
+		for _, key := range slices.Sorted(maps.Keys(current)) {
+			if !slices.ContainsFunc(state.Devices, func(device concourse.StateDevice) bool { return deviceKey(device.Site, device.Name) == key }) {
+				deviceDeletes = append(deviceDeletes, PlannedChange{Action: applyDelete, ObjectType: "devices", Key: key, Id: current[key].Id})
+			}
+		}
+	}
+
+	// children are deleted before their parents
+	plan = append(plan, ipAddressDeletes...)
+	plan = append(plan, interfaceDeletes...)
+	plan = append(plan, deviceDeletes...)
+	if plan == nil {
+		plan = []PlannedChange{}
+	}
+	return plan, nil
+}
+
+func planObject(objectType string, key string, parent string, current currentObject, exists bool, fields []stateField, createFields map[string]any) *PlannedChange {
+	if !exists {
+		for _, field := range fields {
+			createFields[field.name] = field.value
+		}
+		return &PlannedChange{Action: applyCreate, ObjectType: objectType, Key: key, Parent: parent, Fields: createFields}
+	}
+
+	changedFields := map[string]any{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(normalizeValue(field.desired), normalizeValue(field.current)) {
+			changedFields[field.name] = field.value
+		}
+	}
+	if len(changedFields) == 0 {
+		return nil
+	}
+	return &PlannedChange{Action: applyUpdate, ObjectType: objectType, Key: key, Id: current.Id, Fields: changedFields}
+}
+
+func planDeletes(objectType string, parent string, current map[string]currentObject, declared []string) []PlannedChange {
+	deletes := []PlannedChange{}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		if !slices.Contains(declared, name) {
+			deletes = append(deletes, PlannedChange{Action: applyDelete, ObjectType: objectType, Key: childKey(parent, name), Id: current[name].Id})
+		}
+	}
+	return deletes
+}
+
+func appendChange(plan []PlannedChange, change *PlannedChange) []PlannedChange {
+	if change == nil {
+		return plan
+	}
+	return append(plan, *change)
+}
+
+func deviceFields(device concourse.StateDevice, current map[string]any, references applyReferences) ([]stateField, error) {
+	fields := []stateField{}
+	if len(device.Role) > 0 {
+		fields = append(fields, stateField{"role", device.Role, nestedValue(current, "role", "slug"), references.Roles[device.Role]})
+	}
+	if len(device.DeviceType) > 0 {
+		fields = append(fields, stateField{"device_type", device.DeviceType, nestedValue(current, "device_type", "slug"), references.DeviceTypes[device.DeviceType]})
+	}
+	if len(device.Status) > 0 {
+		if _, err := netbox.NewDeviceStatusValueFromValue(device.Status); err != nil {
+			return nil, fmt.Errorf("invalid status: %w", err)
+		}
+		fields = append(fields, stateField{"status", device.Status, nestedValue(current, "status", "value"), device.Status})
+	}
+	if device.Serial != nil {
+		fields = append(fields, stateField{"serial", *device.Serial, nestedValue(current, "serial"), *device.Serial})
+	}
+	if device.Description != nil {
+		fields = append(fields, stateField{"description", *device.Description, nestedValue(current, "description"), *device.Description})
+	}
+	return appendCommonFields(fields, device.Tags, device.CustomFields, current, references), nil
+}
+
+func interfaceFields(iface concourse.StateInterface, current map[string]any, references applyReferences) ([]stateField, error) {
+	fields := []stateField{}
+	if len(iface.Type) > 0 {
+		if _, err := netbox.NewInterfaceTypeValueFromValue(iface.Type); err != nil {
+			return nil, fmt.Errorf("invalid type: %w", err)
+		}
+		fields = append(fields, stateField{"type", iface.Type, nestedValue(current, "type", "value"), iface.Type})
+	}
+	if iface.Enabled != nil {
+		fields = append(fields, stateField{"enabled", *iface.Enabled, nestedValue(current, "enabled"), *iface.Enabled})
+	}
+	if iface.MgmtOnly != nil {
+		fields = append(fields, stateField{"mgmt_only", *iface.MgmtOnly, nestedValue(current, "mgmt_only"), *iface.MgmtOnly})
+	}
+	if iface.Description != nil {
+		fields = append(fields, stateField{"description", *iface.Description, nestedValue(current, "description"), *iface.Description})
+	}
+	if iface.Mtu != nil {
+		fields = append(fields, stateField{"mtu", *iface.Mtu, nestedValue(current, "mtu"), *iface.Mtu})
+	}
+	return appendCommonFields(fields, iface.Tags, iface.CustomFields, current, references), nil
+}
+
+func ipAddressFields(ipAddress concourse.StateIpAddress, current map[string]any, references applyReferences) ([]stateField, error) {
+	fields := []stateField{}
+	if len(ipAddress.Status) > 0 {
+		if _, err := netbox.NewIPAddressStatusValueFromValue(ipAddress.Status); err != nil {
+			return nil, fmt.Errorf("invalid status: %w", err)
+		}
+		fields = append(fields, stateField{"status", ipAddress.Status, nestedValue(current, "status", "value"), ipAddress.Status})
+	}
+	if ipAddress.DnsName != nil {
+		fields = append(fields, stateField{"dns_name", *ipAddress.DnsName, nestedValue(current, "dns_name"), *ipAddress.DnsName})
+	}
+	if ipAddress.Description != nil {
+		fields = append(fields, stateField{"description", *ipAddress.Description, nestedValue(current, "description"), *ipAddress.Description})
+	}
+	return appendCommonFields(fields, ipAddress.Tags, ipAddress.CustomFields, current, references), nil
+}
+
+func appendCommonFields(fields []stateField, tags []string, customFields map[string]any, current map[string]any, references applyReferences) []stateField {
+	// a declared empty list removes all tags, while omitted tags are left untouched
+	if tags != nil {
+		tagIds := make([]int32, 0, len(tags))
+		for _, slug := range tags {
+			tagIds = append(tagIds, references.Tags[slug])
+		}
+		fields = append(fields, stateField{"tags", slices.Sorted(slices.Values(tags)), slices.Sorted(slices.Values(tagSlugs(current))), tagIds})
+	}
+
+	// custom fields not declared in the desired state are left untouched
+	if len(customFields) > 0 {
+		currentCustomFields := map[string]any{}
+		for name := range customFields {
+			currentCustomFields[name] = nestedValue(current, "custom_fields", name)
+		}
+		fields = append(fields, stateField{"custom_fields", customFields, currentCustomFields, customFields})
+	}
+	return fields
+}
+
+func executeChange(client *netbox.APIClient, change PlannedChange, ids map[string]int32, dryRun bool, ctx context.Context) error {
+	// the fields are sent as is, the typed request fields only serve the client
+	fields := maps.Clone(change.Fields)
+	if change.Action == applyCreate && len(change.Parent) > 0 {
+		parentId, ok := ids[change.Parent]
+		switch {
+		case ok:
+			fields[parentFields[change.ObjectType]] = parentId
+		case dryRun:
+			fields[parentFields[change.ObjectType]] = placeholderId(change.Parent)
+		default:
+			return fmt.Errorf("parent %s was not found", change.Parent)
+		}
+	}
+
+	request := PlannedRequest{Path: objectPath(applyEndpoints[change.ObjectType], change.Id)}
+	switch change.Action {
+	case applyCreate:
+		request = PlannedRequest{Method: http.MethodPost, Path: listPath(applyEndpoints[change.ObjectType]), Body: fields}
+	case applyUpdate:
+		request.Method = http.MethodPatch
+		request.Body = fields
+	case applyDelete:
+		request.Method = http.MethodDelete
+	}
+
+	return write(client, dryRun, request, func() error {
+		switch change.ObjectType + " " + change.Action {
+		case "devices create":
+			device, _, err := client.DcimAPI.DcimDevicesCreate(ctx).WritableDeviceWithConfigContextRequest(netbox.WritableDeviceWithConfigContextRequest{AdditionalProperties: fields}).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimDevicesCreate request: %w", err)
+			}
+			ids[change.Key] = device.Id
+		case "devices update":
+			_, _, err := client.DcimAPI.DcimDevicesPartialUpdate(ctx, change.Id).PatchedWritableDeviceWithConfigContextRequest(netbox.PatchedWritableDeviceWithConfigContextRequest{AdditionalProperties: fields}).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimDevicesPartialUpdate request: %w", err)
+			}
+		case "devices delete":
+			if _, err := client.DcimAPI.DcimDevicesDestroy(ctx, change.Id).Execute(); err != nil {
+				return fmt.Errorf("error during DcimDevicesDestroy request: %w", err)
+			}
+		case "interfaces create":
+			iface, _, err := client.DcimAPI.DcimInterfacesCreate(ctx).WritableInterfaceRequest(netbox.WritableInterfaceRequest{AdditionalProperties: fields}).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimInterfacesCreate request: %w", err)
+			}
+			ids[change.Key] = iface.Id
+		case "interfaces update":
+			_, _, err := client.DcimAPI.DcimInterfacesPartialUpdate(ctx, change.Id).PatchedWritableInterfaceRequest(netbox.PatchedWritableInterfaceRequest{AdditionalProperties: fields}).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimInterfacesPartialUpdate request: %w", err)
+			}
+		case "interfaces delete":
+			if _, err := client.DcimAPI.DcimInterfacesDestroy(ctx, change.Id).Execute(); err != nil {
+				return fmt.Errorf("error during DcimInterfacesDestroy request: %w", err)
+			}
+		case "ip-addresses create":
+			ipAddress, _, err := client.IpamAPI.IpamIpAddressesCreate(ctx).WritableIPAddressRequest(netbox.WritableIPAddressRequest{AdditionalProperties: fields}).Execute()
+			if err != nil {
+				return fmt.Errorf("error during IpamIpAddressesCreate request: %w", err)
+			}
+			ids[change.Key] = ipAddress.Id
+		case "ip-addresses update":
+			_, _, err := client.IpamAPI.IpamIpAddressesPartialUpdate(ctx, change.Id).PatchedWritableIPAddressRequest(netbox.PatchedWritableIPAddressRequest{AdditionalProperties: fields}).Execute()
+			if err != nil {
+				return fmt.Errorf("error during IpamIpAddressesPartialUpdate request: %w", err)
+			}
+		case "ip-addresses delete":
+			if _, err := client.IpamAPI.IpamIpAddressesDestroy(ctx, change.Id).Execute(); err != nil {
+				return fmt.Errorf("error during IpamIpAddressesDestroy request: %w", err)
+			}
+		default:
+			return fmt.Errorf("unsupported change")
+		}
+		return nil
+	}, ctx)
+}
+
+func loadCurrentState(client *netbox.APIClient, apply concourse.Apply, ctx context.Context) (map[string]currentObject, error) {
+	current := map[string]currentObject{}
+	sites := []string{}
+	for _, device := range apply.State.Devices {
+		if !slices.Contains(sites, device.Site) {
+			sites = append(sites, device.Site)
+		}
+
+		deviceList, _, err := client.DcimAPI.DcimDevicesList(ctx).Site([]string{device.Site}).Name([]string{device.Name}).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("error during DcimDevicesList query: %w", err)
+		}
+		if len(deviceList.Results) == 0 {
+			continue
+		}
+
+		currentDevice, err := loadCurrentDevice(client, deviceList.Results[0], ctx)
+		if err != nil {
+			return nil, err
+		}
+		current[deviceKey(device.Site, device.Name)] = currentDevice
+	}
+
+	// undeclared devices are only owned by the desired state, if they carry the prune tag
+	if apply.Prune && len(apply.PruneTag) > 0 && len(sites) > 0 {
+		deviceList, err := runPagedDeviceQuery(client, filter.NetboxObject{SiteName: sites, Tag: []string{apply.PruneTag}}, ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range deviceList {
+			key := deviceKey(device.Site.Slug, device.GetName())
+			if _, ok := current[key]; !ok && len(device.GetName()) > 0 {
+				current[key] = currentObject{Id: device.Id}
+			}
+		}
+	}
+	return current, nil
+}
+
+func loadCurrentDevice(client *netbox.APIClient, device netbox.DeviceWithConfigContext, ctx context.Context) (currentObject, error) {
+	deviceFields, err := objectFields(device)
+	if err != nil {
+		return currentObject{}, err
+	}
+	currentDevice := currentObject{Id: device.Id, Fields: deviceFields, Children: map[string]currentObject{}}
+
+	interfaceList, err := runPagedInterfaceQuery(client, filter.NetboxObject{}, device.Id, ctx)
+	if err != nil {
+		return currentObject{}, err
+	}
+	ipAddressList, err := runPagedIpAddressQuery(client, device.Id, ctx)
+	if err != nil {
+		return currentObject{}, err
+	}
+
+	for _, iface := range interfaceList {
+		interfaceFields, err := objectFields(iface)
+		if err != nil {
+			return currentObject{}, err
+		}
+		currentInterface := currentObject{Id: iface.Id, Fields: interfaceFields, Children: map[string]currentObject{}}
+		for _, ipAddress := range ipAddressList {
+			if ipAddress.GetAssignedObjectType() != "dcim.interface" || ipAddress.GetAssignedObjectId() != int64(iface.Id) {
+				continue
+			}
+			ipAddressFields, err := objectFields(ipAddress)
+			if err != nil {
+				return currentObject{}, err
+			}
+			currentInterface.Children[ipAddress.Address] = currentObject{Id: ipAddress.Id, Fields: ipAddressFields}
+		}
+		currentDevice.Children[iface.Name] = currentInterface
+	}
+	return currentDevice, nil
+}
+
+func loadApplyReferences(client *netbox.APIClient, state concourse.State, ctx context.Context) (applyReferences, error) {
+	var (
+		sites       []string
+		roles       []string
+		deviceTypes []string
+		tags        []string
+		references  applyReferences
+	)
+
+	addSlug := func(slugs []string, slug string) []string {
+		if len(slug) == 0 || slices.Contains(slugs, slug) {
+			return slugs
+		}
+		return append(slugs, slug)
+	}
+	for _, device := range state.Devices {
+		sites = addSlug(sites, device.Site)
+		roles = addSlug(roles, device.Role)
+		deviceTypes = addSlug(deviceTypes, device.DeviceType)
+		for _, tag := range device.Tags {
+			tags = addSlug(tags, tag)
+		}
+		for _, iface := range device.Interfaces {
+			for _, tag := range iface.Tags {
+				tags = addSlug(tags, tag)
+			}
+			for _, ipAddress := range iface.IpAddresses {
+				for _, tag := range ipAddress.Tags {
+					tags = addSlug(tags, tag)
+				}
+			}
+		}
+	}
+
+	references.Sites = map[string]int32{}
+	if len(sites) > 0 {
+		siteList, _, err := client.DcimAPI.DcimSitesList(ctx).Slug(sites).Limit(int32(len(sites))).Execute()
+		if err != nil {
+			return references, fmt.Errorf("error during DcimSitesList query: %w", err)
+		}
+		for _, site := range siteList.Results {
+			references.Sites[site.Slug] = site.Id
+		}
+	}
+
+	references.Roles = map[string]int32{}
+	if len(roles) > 0 {
+		roleList, _, err := client.DcimAPI.DcimDeviceRolesList(ctx).Slug(roles).Limit(int32(len(roles))).Execute()
+		if err != nil {
+			return references, fmt.Errorf("error during DcimDeviceRolesList query: %w", err)
+		}
+		for _, role := range roleList.Results {
+			references.Roles[role.Slug] = role.Id
+		}
+	}
+
+	references.DeviceTypes = map[string]int32{}
+	if len(deviceTypes) > 0 {
+		deviceTypeList, _, err := client.DcimAPI.DcimDeviceTypesList(ctx).Slug(deviceTypes).Limit(int32(len(deviceTypes))).Execute()
+		if err != nil {
+			return references, fmt.Errorf("error during DcimDeviceTypesList query: %w", err)
+		}
+		for _, deviceType := range deviceTypeList.Results {
+			references.DeviceTypes[deviceType.Slug] = deviceType.Id
+		}
+	}
+
+	references.Tags = map[string]int32{}
+	if len(tags) > 0 {
+		tagList, _, err := client.ExtrasAPI.ExtrasTagsList(ctx).Slug(tags).Limit(int32(len(tags))).Execute()
+		if err != nil {
+			return references, fmt.Errorf("error during ExtrasTagsList query: %w", err)
+		}
+		for _, tag := range tagList.Results {
+			references.Tags[tag.Slug] = tag.Id
+		}
+	}
+
+	for _, check := range []struct {
+		kind  string
+		slugs []string
+		ids   map[string]int32
+	}{
+		{"site", sites, references.Sites},
+		{"device role", roles, references.Roles},
+		{"device type", deviceTypes, references.DeviceTypes},
+		{"tag", tags, references.Tags},
+	} {
+		for _, slug := range check.slugs {
+			if _, ok := check.ids[slug]; !ok {
+				return references, fmt.Errorf("%s %s is not defined in NetBox", check.kind, slug)
+			}
+		}
+	}
+	return references, nil
+}
+
+func currentIds(current map[string]currentObject) map[string]int32 {
+	ids := map[string]int32{}
+	for key, device := range current {
+		ids[key] = device.Id
+		for name, iface := range device.Children {
+			interfaceKey := childKey(key, name)
+			ids[interfaceKey] = iface.Id
+			for address, ipAddress := range iface.Children {
+				ids[childKey(interfaceKey, address)] = ipAddress.Id
+			}
+		}
+	}
+	return ids
+}
+
+func objectFields(object any) (map[string]any, error) {
+	var (
+		fields map[string]any
+	)
+
+	objectBytes, err := json.Marshal(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	if err := json.Unmarshal(objectBytes, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode object: %w", err)
+	}
+	return fields, nil
+}
+
+func tagSlugs(fields map[string]any) []string {
+	tags, _ := nestedValue(fields, "tags").([]any)
+	slugs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if slug, ok := nestedValue(tag, "slug").(string); ok {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+func nestedValue(value any, path ...string) any {
+	for _, key := range path {
+		valueMap, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = valueMap[key]
+	}
+	return value
+}
+
+// desired values are compared in their JSON representation, as numbers of the current state are decoded as float64
+func normalizeValue(value any) any {
+	var (
+		normalized any
+	)
+
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	if err := json.Unmarshal(valueBytes, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func deviceKey(site string, name string) string {
+	return site + "/" + name
+}
+
+func childKey(parent string, name string) string {
+	return parent + "/" + name
+}
@@ -0,0 +1,189 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestPlanState(t *testing.T) {
+	description := "uplink"
+	mtu := int32(9000)
+	references := applyReferences{
+		Sites:       map[string]int32{"site-a": 1},
+		Roles:       map[string]int32{"server": 2},
+		DeviceTypes: map[string]int32{"r640": 3},
+		Tags:        map[string]int32{"managed": 4},
+	}
+	current := map[string]currentObject{
+		"site-a/server01": {
+			Id: 10,
+			Fields: map[string]any{
+				"role":          map[string]any{"slug": "server"},
+				"status":        map[string]any{"value": "active"},
+				"tags":          []any{map[string]any{"slug": "managed"}},
+				"custom_fields": map[string]any{"owner": "team-a"},
+			},
+			Children: map[string]currentObject{
+				"eth0": {
+					Id:     20,
+					Fields: map[string]any{"mtu": float64(1500), "description": "uplink"},
+					Children: map[string]currentObject{
+						"10.0.0.5/24": {Id: 30, Fields: map[string]any{"status": map[string]any{"value": "active"}}},
+					},
+				},
+				"eth1": {Id: 21, Fields: map[string]any{}},
+			},
+		},
+		"site-a/server99": {Id: 11},
+	}
+	device := concourse.StateDevice{
+		Site:         "site-a",
+		Name:         "server01",
+		Role:         "server",
+		Status:       "active",
+		Tags:         []string{"managed"},
+		CustomFields: map[string]any{"owner": "team-a"},
+		Interfaces: []concourse.StateInterface{
+			{Name: "eth0", Description: &description, Mtu: &mtu, IpAddresses: []concourse.StateIpAddress{{Address: "10.0.0.5/24", Status: "active"}}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		state    concourse.State
+		prune    bool
+		expected []PlannedChange
+		wantErr  bool
+	}{
+		{
+			"updateChangedFieldsOnly",
+			concourse.State{Devices: []concourse.StateDevice{device}},
+			false,
+			[]PlannedChange{{Action: "update", ObjectType: "interfaces", Key: "site-a/server01/eth0", Id: 20, Fields: map[string]any{"mtu": mtu}}},
+			false,
+		},
+		{
+			"pruneUndeclaredObjects",
+			concourse.State{Devices: []concourse.StateDevice{device}},
+			true,
+			[]PlannedChange{
+				{Action: "update", ObjectType: "interfaces", Key: "site-a/server01/eth0", Id: 20, Fields: map[string]any{"mtu": mtu}},
+				{Action: "delete", ObjectType: "interfaces", Key: "site-a/server01/eth1", Id: 21},
+				{Action: "delete", ObjectType: "devices", Key: "site-a/server99", Id: 11},
+			},
+			false,
+		},
+		{
+			"createDevice",
+			concourse.State{Devices: []concourse.StateDevice{{
+				Site:       "site-a",
+				Name:       "server02",
+				Role:       "server",
+				DeviceType: "r640",
+				Interfaces: []concourse.StateInterface{{Name: "eth0", Type: "1000base-t"}},
+			}}},
+			false,
+			[]PlannedChange{
+				{Action: "create", ObjectType: "devices", Key: "site-a/server02", Fields: map[string]any{"name": "server02", "site": int32(1), "role": int32(2), "device_type": int32(3)}},
+				{Action: "create", ObjectType: "interfaces", Key: "site-a/server02/eth0", Parent: "site-a/server02", Fields: map[string]any{"name": "eth0", "type": "1000base-t"}},
+			},
+			false,
+		},
+		{
+			"createDeviceWithoutRole",
+			concourse.State{Devices: []concourse.StateDevice{{Site: "site-a", Name: "server02", DeviceType: "r640"}}},
+			false,
+			nil,
+			true,
+		},
+		{
+			"invalidStatus",
+			concourse.State{Devices: []concourse.StateDevice{{Site: "site-a", Name: "server01", Status: "broken"}}},
+			false,
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := planState(test.state, current, references, test.prune)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("planState() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected plan %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateState(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   concourse.State
+		wantErr bool
+	}{
+		{"valid", concourse.State{Devices: []concourse.StateDevice{{Site: "site-a", Name: "server01"}, {Site: "site-b", Name: "server01"}}}, false},
+		{"missingSite", concourse.State{Devices: []concourse.StateDevice{{Name: "server01"}}}, true},
+		{"duplicateDevice", concourse.State{Devices: []concourse.StateDevice{{Site: "site-a", Name: "server01"}, {Site: "site-a", Name: "server01"}}}, true},
+		{"duplicateInterface", concourse.State{Devices: []concourse.StateDevice{{Site: "site-a", Name: "server01", Interfaces: []concourse.StateInterface{{Name: "eth0"}, {Name: "eth0"}}}}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateState(test.state)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateState() error: '%v', error expected: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecutePlanPartialFailure(t *testing.T) {
+	plan := []PlannedChange{
+		{Action: applyUpdate, ObjectType: "devices", Key: "site-a/server-1", Id: 1, Fields: map[string]any{"status": "active"}},
+		{Action: applyCreate, ObjectType: "interfaces", Key: "site-a/server-1/eth0", Parent: "site-a/server-1", Fields: map[string]any{"name": "eth0", "type": "1000base-t"}},
+		{Action: applyUpdate, ObjectType: "devices", Key: "site-a/server-2", Id: 2, Fields: map[string]any{"status": "active"}},
+		{Action: applyDelete, ObjectType: "devices", Key: "site-a/server-3", Id: 3},
+	}
+
+	var created map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "PATCH /api/dcim/devices/1/":
+			_ = json.NewEncoder(w).Encode(testDevice(1, "server-1", map[string]any{}))
+		case "POST /api/dcim/interfaces/":
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(testInterface(10, "eth0", "2025-01-01T00:00:00Z"))
+		case "PATCH /api/dcim/devices/2/":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":["invalid"]}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := netbox.NewAPIClientFor(server.URL, "")
+	applied, err := executePlan(client, plan, map[string]int32{"site-a/server-1": 1}, false, context.Background())
+	if err == nil {
+		t.Fatal("expected error of the failed device update")
+	}
+	if !reflect.DeepEqual(applied, plan[:2]) {
+		t.Errorf("expected the changes before the failure, got %v", applied)
+	}
+	if created["device"] != 1.0 {
+		t.Errorf("expected interface created on device 1, got %v", created)
+	}
+}
@@ -0,0 +1,148 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+const (
+	defaultChunkSize int = 100
+)
+
+type BulkResult struct {
+	Updated int              `json:"updated"`
+	Chunks  int              `json:"chunks"`
+	Errors  []BulkChunkError `json:"errors,omitempty"`
+}
+
+type BulkChunkError struct {
+	Chunk      int     `json:"chunk"`
+	ObjectType string  `json:"object_type"`
+	Ids        []int32 `json:"ids"`
+	Error      string  `json:"error"`
+}
+
+type bulkChunk struct {
+	ObjectType string
+	Updates    []concourse.BulkUpdate
+}
+
+func (chunkError BulkChunkError) String() string {
+	return fmt.Sprintf("chunk %d (%d %s): %s", chunkError.Chunk, len(chunkError.Ids), chunkError.ObjectType, chunkError.Error)
+}
+
+func (result BulkResult) String() string {
+	return fmt.Sprintf("%d objects updated in %d of %d chunks", result.Updated, result.Chunks-len(result.Errors), result.Chunks)
+}
+
+func BulkUpdate(input concourse.Input, ctx context.Context) (BulkResult, error) {
+	var (
+		result BulkResult
+	)
+
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	bulk := input.Params.Bulk
+	if bulk == nil || len(bulk.Updates) == 0 {
+		return result, fmt.Errorf("params.bulk requires updates in file or updates")
+	}
+	if err := validateBulkUpdates(bulk.Updates); err != nil {
+		return result, err
+	}
+
+	chunks := bulkChunks(bulk.Updates, bulk.ChunkSize)
+	result.Chunks = len(chunks)
+	// a chunk is applied atomically by NetBox, so the following chunks are still sent after a failed one
+	for i, chunk := range chunks {
+		body := make([]map[string]any, 0, len(chunk.Updates))
+		ids := make([]int32, 0, len(chunk.Updates))
+		for _, update := range chunk.Updates {
+			fields := maps.Clone(update.Fields)
+			fields["id"] = update.Id
+			body = append(body, fields)
+			ids = append(ids, update.Id)
+		}
+
+		request := PlannedRequest{Method: http.MethodPatch, Path: listPath(applyEndpoints[chunk.ObjectType]), Body: body}
+		err := write(client, input.Params.DryRun, request, func() error {
+			var updated []map[string]any
+			return requestResult(client, http.MethodPatch, request.Path, body, &updated, ctx)
+		}, ctx)
+		if err != nil {
+			result.Errors = append(result.Errors, BulkChunkError{Chunk: i + 1, ObjectType: chunk.ObjectType, Ids: ids, Error: err.Error()})
+			continue
+		}
+		result.Updated += len(chunk.Updates)
+	}
+
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("%d of %d chunks failed", len(result.Errors), result.Chunks)
+	}
+	return result, nil
+}
+
+func validateBulkUpdates(updates []concourse.BulkUpdate) error {
+	seen := map[string]bool{}
+	for _, update := range updates {
+		objectType := bulkObjectType(update)
+		if _, ok := applyEndpoints[objectType]; !ok {
+			return fmt.Errorf("unsupported object_type '%s' in params.bulk, expected one of %v", update.ObjectType, slices.Sorted(maps.Keys(applyEndpoints)))
+		}
+		if update.Id <= 0 {
+			return fmt.Errorf("updates in params.bulk require an id")
+		}
+		if len(update.Fields) == 0 {
+			return fmt.Errorf("update of %s %d in params.bulk has no fields", objectType, update.Id)
+		}
+		if _, ok := update.Fields["id"]; ok {
+			return fmt.Errorf("update of %s %d in params.bulk must not set the id field", objectType, update.Id)
+		}
+
+		key := fmt.Sprintf("%s/%d", objectType, update.Id)
+		if seen[key] {
+			return fmt.Errorf("%s %d is updated more than once in params.bulk", objectType, update.Id)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// bulkChunks groups the updates by object type in the order of their first occurrence
+func bulkChunks(updates []concourse.BulkUpdate, chunkSize int) []bulkChunk {
+	var (
+		objectTypes []string
+		chunks      []bulkChunk
+	)
+
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	grouped := map[string][]concourse.BulkUpdate{}
+	for _, update := range updates {
+		objectType := bulkObjectType(update)
+		if _, ok := grouped[objectType]; !ok {
+			objectTypes = append(objectTypes, objectType)
+		}
+		grouped[objectType] = append(grouped[objectType], update)
+	}
+	for _, objectType := range objectTypes {
+		for chunk := range slices.Chunk(grouped[objectType], chunkSize) {
+			chunks = append(chunks, bulkChunk{ObjectType: objectType, Updates: chunk})
+		}
+	}
+	return chunks
+}
+
+func bulkObjectType(update concourse.BulkUpdate) string {
+	if len(update.ObjectType) == 0 {
+		return "devices"
+	}
+	return update.ObjectType
+}
@@ -0,0 +1,121 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestBulkChunks(t *testing.T) {
+	fields := map[string]any{"status": "active"}
+	updates := []concourse.BulkUpdate{
+		{Id: 1, Fields: fields},
+		{ObjectType: "interfaces", Id: 10, Fields: fields},
+		{ObjectType: "devices", Id: 2, Fields: fields},
+		{Id: 3, Fields: fields},
+	}
+
+	tests := []struct {
+		name      string
+		chunkSize int
+		expected  map[string][][]int32
+		chunks    int
+	}{
+		{"default", 0, map[string][][]int32{"devices": {{1, 2, 3}}, "interfaces": {{10}}}, 2},
+		{"chunked", 2, map[string][][]int32{"devices": {{1, 2}, {3}}, "interfaces": {{10}}}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunks := bulkChunks(updates, test.chunkSize)
+			if len(chunks) != test.chunks {
+				t.Fatalf("expected %d chunks, got %d", test.chunks, len(chunks))
+			}
+			if chunks[0].ObjectType != "devices" {
+				t.Errorf("expected the first chunk to update devices, got %s", chunks[0].ObjectType)
+			}
+			result := map[string][][]int32{}
+			for _, chunk := range chunks {
+				ids := []int32{}
+				for _, update := range chunk.Updates {
+					ids = append(ids, update.Id)
+				}
+				result[chunk.ObjectType] = append(result[chunk.ObjectType], ids)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateBulkUpdates(t *testing.T) {
+	fields := map[string]any{"status": "active"}
+
+	tests := []struct {
+		name    string
+		updates []concourse.BulkUpdate
+		wantErr bool
+	}{
+		{"valid", []concourse.BulkUpdate{{Id: 1, Fields: fields}, {ObjectType: "interfaces", Id: 1, Fields: fields}}, false},
+		{"unsupportedObjectType", []concourse.BulkUpdate{{ObjectType: "sites", Id: 1, Fields: fields}}, true},
+		{"missingId", []concourse.BulkUpdate{{Fields: fields}}, true},
+		{"missingFields", []concourse.BulkUpdate{{Id: 1}}, true},
+		{"idField", []concourse.BulkUpdate{{Id: 1, Fields: map[string]any{"id": 2}}}, true},
+		{"duplicate", []concourse.BulkUpdate{{Id: 1, Fields: fields}, {ObjectType: "devices", Id: 1, Fields: fields}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateBulkUpdates(test.updates)
+			if (err != nil) != test.wantErr {
+				t.Errorf("expected error: %v, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBulkUpdatePartialFailure(t *testing.T) {
+	var received [][]map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []map[string]any
+		if r.Method != http.MethodPatch || r.URL.Path != "/api/dcim/devices/" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		received = append(received, body)
+		w.Header().Set("Content-Type", "application/json")
+		if body[0]["id"] == 2.0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"serial":["invalid"]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	fields := map[string]any{"serial": "abc"}
+	input := concourse.Input{
+		Source: concourse.Source{Url: server.URL},
+		Params: concourse.Params{Bulk: &concourse.Bulk{ChunkSize: 1, Updates: []concourse.BulkUpdate{{Id: 1, Fields: fields}, {Id: 2, Fields: fields}, {Id: 3, Fields: fields}}}},
+	}
+	result, err := BulkUpdate(input, context.Background())
+	if err == nil {
+		t.Fatal("expected error of the failed chunk")
+	}
+	if len(received) != 3 {
+		t.Errorf("expected the remaining chunks to be sent after the failure, got %v", received)
+	}
+	if result.String() != "2 objects updated in 2 of 3 chunks" {
+		t.Errorf("unexpected summary %q", result.String())
+	}
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0].String(), "chunk 2 (1 devices): ") {
+		t.Errorf("unexpected chunk errors %v", result.Errors)
+	}
+}
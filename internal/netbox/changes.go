@@ -0,0 +1,139 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+const (
+	// change records are written shortly after the object, while version.last_updated is truncated to seconds
+	changeTimeTolerance time.Duration = 5 * time.Second
+)
+
+type ChangeRecord struct {
+	Id             int32  `json:"id"`
+	Time           string `json:"time"`
+	UserName       string `json:"user_name"`
+	RequestId      string `json:"request_id"`
+	Action         string `json:"action"`
+	PrechangeData  any    `json:"prechange_data"`
+	PostchangeData any    `json:"postchange_data"`
+}
+
+type FieldDiff struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+type Changes struct {
+	Version concourse.Version `json:"version"`
+	Records []ChangeRecord    `json:"records"`
+	Diff    []FieldDiff       `json:"diff"`
+}
+
+func ObjectChanges(input concourse.Input, since time.Time, ctx context.Context) (Changes, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	objectId, err := getObjectId(input.Version)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	until, err := getReferenceTime(input.Version.LastUpdated)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	changeList, err := runPagedObjectChangeQuery(client, input.Version.ObjectType, objectId, since, until.Add(changeTimeTolerance), ctx)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	// without a start time only the request that produced the current version is of interest
+	if since.IsZero() && len(changeList) > 0 {
+		requestId := changeList[len(changeList)-1].RequestId
+		changeList = slices.DeleteFunc(changeList, func(change netbox.ObjectChange) bool {
+			return change.RequestId != requestId
+		})
+	}
+
+	changes := Changes{
+		Version: input.Version,
+		Records: make([]ChangeRecord, 0, len(changeList)),
+		Diff:    []FieldDiff{},
+	}
+	for _, change := range changeList {
+		changes.Records = append(changes.Records, ChangeRecord{
+			Id:             change.Id,
+			Time:           change.Time.UTC().Format(time.RFC3339),
+			UserName:       change.UserName,
+			RequestId:      change.RequestId,
+			Action:         string(change.Action.GetValue()),
+			PrechangeData:  change.PrechangeData,
+			PostchangeData: change.PostchangeData,
+		})
+	}
+	if len(changes.Records) > 0 {
+		changes.Diff = computeDiff(changes.Records[0].PrechangeData, changes.Records[len(changes.Records)-1].PostchangeData)
+	}
+	return changes, nil
+}
+
+func runPagedObjectChangeQuery(client *netbox.APIClient, objectType string, objectId int32, since time.Time, until time.Time, ctx context.Context) ([]netbox.ObjectChange, error) {
+	changeList := make([]netbox.ObjectChange, 0, 25)
+	limit := int32(25)
+	offset := int32(0)
+	for {
+		pagedQuery := client.CoreAPI.CoreObjectChangesList(ctx).
+			ChangedObjectType(contentType(objectType)).
+			ChangedObjectId([]int32{objectId}).
+			TimeBefore(until).
+			Ordering("time").
+			Limit(limit).
+			Offset(offset)
+		if !since.IsZero() {
+			pagedQuery = pagedQuery.TimeAfter(since)
+		}
+		changeQueryResponse, _, err := pagedQuery.Execute()
+		if err != nil {
+			return nil, fmt.Errorf("error during CoreObjectChangesList query: %w", err)
+		}
+		changeList = append(changeList, changeQueryResponse.Results...)
+		if !changeQueryResponse.Next.IsSet() || changeQueryResponse.Next.Get() == nil || *changeQueryResponse.Next.Get() == "" || len(changeQueryResponse.Results) == 0 {
+			break
+		}
+		offset += limit
+	}
+	return changeList, nil
+}
+
+func computeDiff(before any, after any) []FieldDiff {
+	beforeMap, _ := before.(map[string]any)
+	afterMap, _ := after.(map[string]any)
+
+	fields := make([]string, 0, len(beforeMap)+len(afterMap))
+	for field := range beforeMap {
+		fields = append(fields, field)
+	}
+	for field := range afterMap {
+		if _, ok := beforeMap[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+
+	diff := []FieldDiff{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(beforeMap[field], afterMap[field]) {
+			diff = append(diff, FieldDiff{Field: field, Before: beforeMap[field], After: afterMap[field]})
+		}
+	}
+	return diff
+}
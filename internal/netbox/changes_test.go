@@ -0,0 +1,30 @@
+package netbox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   any
+		after    any
+		expected []FieldDiff
+	}{
+		{"noChange", map[string]any{"status": "active"}, map[string]any{"status": "active"}, []FieldDiff{}},
+		{"changedField", map[string]any{"status": "planned", "name": "srv01"}, map[string]any{"status": "active", "name": "srv01"}, []FieldDiff{{Field: "status", Before: "planned", After: "active"}}},
+		{"created", nil, map[string]any{"name": "srv01"}, []FieldDiff{{Field: "name", Before: nil, After: "srv01"}}},
+		{"deleted", map[string]any{"name": "srv01"}, nil, []FieldDiff{{Field: "name", Before: "srv01", After: nil}}},
+		{"nestedChange", map[string]any{"tags": []any{"a"}}, map[string]any{"tags": []any{"a", "b"}}, []FieldDiff{{Field: "tags", Before: []any{"a"}, After: []any{"a", "b"}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := computeDiff(test.before, test.after)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected diff %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
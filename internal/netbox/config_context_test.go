@@ -56,9 +56,6 @@ func TestConfigContextParsing(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			// Reset global output variable before each test
-			output = make([]concourse.Version, 0)
-
 			input := concourse.Input{
 				Source: concourse.Source{
 					Filter: filter.NetboxObject{
@@ -0,0 +1,222 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+const (
+	conflictFail      string = "fail"
+	conflictMerge     string = "merge"
+	conflictOverwrite string = "overwrite"
+)
+
+func CheckConflict(input concourse.Input, ctx context.Context) ([]FieldDiff, error) {
+	policy := input.Params.Conflict
+	if len(policy) == 0 {
+		policy = conflictFail
+	}
+	if !slices.Contains([]string{conflictFail, conflictMerge, conflictOverwrite}, policy) {
+		return nil, fmt.Errorf("invalid params.conflict '%s', expected one of %s, %s or %s", policy, conflictFail, conflictMerge, conflictOverwrite)
+	}
+	// the explicit policy would suggest, that the writes of these params are guarded as well
+	if input.Params.Conflict == conflictFail {
+		if unguarded := unguardedParams(input.Params); len(unguarded) > 0 {
+			return nil, fmt.Errorf("params.conflict %s only covers the device and the interface of the version, it can not be combined with %s", conflictFail, strings.Join(unguarded, ", "))
+		}
+	}
+
+	deviceFields := deviceWrittenFields(input.Params, input.Version.ObjectType)
+	interfaceFields := interfaceWrittenFields(input.Params, input.Version.ObjectType)
+	if len(deviceFields) == 0 && len(interfaceFields) == 0 {
+		return nil, nil
+	}
+
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+	// interface versions carry the later timestamp of the device and the interface, so both are compared with it
+	reference, err := getReferenceTime(input.Version.LastUpdated)
+	if err != nil || reference.IsZero() {
+		return nil, err
+	}
+
+	changedFields := []FieldDiff{}
+	if len(deviceFields) > 0 {
+		deviceId, err := getDeviceId(input.Version)
+		if err != nil {
+			return nil, err
+		}
+		device, err := retrieveDevice(client, deviceId, ctx)
+		if err != nil {
+			return nil, err
+		}
+		changed, err := concurrentChanges(client, "devices", deviceId, device.LastUpdated.Get(), reference, ctx)
+		if err != nil {
+			return nil, err
+		}
+		changedFields = append(changedFields, changed...)
+	}
+	if len(interfaceFields) > 0 {
+		interfaceId, err := getObjectId(input.Version)
+		if err != nil {
+			return nil, err
+		}
+		iface, _, err := client.DcimAPI.DcimInterfacesRetrieve(ctx, interfaceId).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("error during DcimInterfacesRetrieve query: %w", err)
+		}
+		changed, err := concurrentChanges(client, "interfaces", interfaceId, iface.LastUpdated.Get(), reference, ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range changed {
+			field.Field = "interface." + field.Field
+			changedFields = append(changedFields, field)
+		}
+	}
+
+	conflicts := conflictingFields(changedFields, append(deviceFields, interfaceFields...), policy)
+	if len(conflicts) > 0 {
+		return changedFields, fmt.Errorf("%s %s was changed since version %s, conflicting fields: %s", input.Version.ObjectType, input.Version.Id, input.Version.LastUpdated, strings.Join(conflicts, ", "))
+	}
+	return changedFields, nil
+}
+
+// concurrentChanges determines the changed fields of the object from the change log, if it was updated after the reference
+func concurrentChanges(client *netbox.APIClient, objectType string, objectId int32, lastUpdated *time.Time, reference time.Time, ctx context.Context) ([]FieldDiff, error) {
+	// version.last_updated is truncated to seconds
+	if lastUpdated == nil || !lastUpdated.UTC().Truncate(time.Second).After(reference) {
+		return nil, nil
+	}
+
+	changeList, err := runPagedObjectChangeQuery(client, objectType, objectId, reference.Add(time.Second), lastUpdated.Add(changeTimeTolerance), ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(changeList) == 0 {
+		return []FieldDiff{{Field: "last_updated", Before: reference.Format(time.RFC3339), After: lastUpdated.UTC().Format(time.RFC3339)}}, nil
+	}
+	return expandCustomFields(computeDiff(changeList[0].PrechangeData, changeList[len(changeList)-1].PostchangeData)), nil
+}
+
+func deviceWrittenFields(params concourse.Params, objectType string) []string {
+	fields := []string{}
+	if len(params.Status) > 0 {
+		fields = append(fields, "status")
+	}
+	if len(params.AddTags) > 0 || len(params.RemoveTags) > 0 {
+		fields = append(fields, "tags")
+	}
+	if objectType != "interfaces" {
+		for _, name := range slices.Sorted(maps.Keys(params.CustomFields)) {
+			fields = append(fields, "custom_fields."+name)
+		}
+	}
+	if params.LocalContext != nil && !targetsVirtualMachine(*params.LocalContext) {
+		fields = append(fields, "local_context_data")
+	}
+	if params.AllocateIp != nil && params.AllocateIp.Primary {
+		fields = append(fields, "primary_ip4", "primary_ip6")
+	}
+	return fields
+}
+
+// interface fields are prefixed, as the changed fields of the device and the interface are reported together
+func interfaceWrittenFields(params concourse.Params, objectType string) []string {
+	fields := []string{}
+	if objectType != "interfaces" {
+		return fields
+	}
+	for _, name := range slices.Sorted(maps.Keys(params.CustomFields)) {
+		fields = append(fields, "interface.custom_fields."+name)
+	}
+	if iface := params.Interface; iface != nil {
+		for _, field := range []struct {
+			name string
+			set  bool
+		}{
+			{"description", iface.Description != nil},
+			{"enabled", iface.Enabled != nil},
+			{"mode", iface.Mode != nil},
+			{"mtu", iface.Mtu != nil},
+			{"primary_mac_address", iface.MacAddress != nil},
+			{"tagged_vlans", iface.TaggedVlans != nil},
+			{"untagged_vlan", iface.UntaggedVlan != nil},
+		} {
+			if field.set {
+				fields = append(fields, "interface."+field.name)
+			}
+		}
+	}
+	return fields
+}
+
+// these params write other objects, whose concurrent changes are not detected
+func unguardedParams(params concourse.Params) []string {
+	unguarded := []string{}
+	for _, param := range []struct {
+		name string
+		set  bool
+	}{
+		{"params.apply", params.Apply != nil},
+		{"params.objects", params.Objects != nil},
+		{"params.bulk", params.Bulk != nil},
+		{"params.lldp", params.Lldp != nil},
+	} {
+		if param.set {
+			unguarded = append(unguarded, param.name)
+		}
+	}
+	return unguarded
+}
+
+func conflictingFields(changedFields []FieldDiff, writtenFields []string, policy string) []string {
+	conflicts := []string{}
+	for _, changed := range changedFields {
+		switch policy {
+		case conflictOverwrite:
+			continue
+		case conflictMerge:
+			// tags are merged with the current tags of the device, so concurrent changes are kept
+			if changed.Field == "tags" || !slices.Contains(writtenFields, changed.Field) {
+				continue
+			}
+		}
+		conflicts = append(conflicts, changed.Field)
+	}
+	return conflicts
+}
+
+// custom fields are written individually, so concurrent changes are compared per custom field
+func expandCustomFields(diff []FieldDiff) []FieldDiff {
+	expanded := []FieldDiff{}
+	for _, field := range diff {
+		if field.Field != "custom_fields" {
+			expanded = append(expanded, field)
+			continue
+		}
+		before, _ := field.Before.(map[string]any)
+		after, _ := field.After.(map[string]any)
+		names := slices.Sorted(maps.Keys(before))
+		for name := range after {
+			if _, ok := before[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if !reflect.DeepEqual(before[name], after[name]) {
+				expanded = append(expanded, FieldDiff{Field: "custom_fields." + name, Before: before[name], After: after[name]})
+			}
+		}
+	}
+	slices.SortFunc(expanded, func(a, b FieldDiff) int { return strings.Compare(a.Field, b.Field) })
+	return expanded
+}
@@ -0,0 +1,213 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestDeviceWrittenFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     concourse.Params
+		objectType string
+		expected   []string
+	}{
+		{"noWrites", concourse.Params{Journal: &concourse.Journal{}}, "devices", []string{}},
+		{"statusAndTags", concourse.Params{Status: "active", AddTags: []string{"burn-in-passed"}}, "devices", []string{"status", "tags"}},
+		{"customFields", concourse.Params{CustomFields: map[string]any{"owner": "team-a", "bios": "2.1"}}, "devices", []string{"custom_fields.bios", "custom_fields.owner"}},
+		{"interfaceCustomFields", concourse.Params{CustomFields: map[string]any{"owner": "team-a"}}, "interfaces", []string{}},
+		{"localContext", concourse.Params{LocalContext: &concourse.LocalContext{Data: map[string]any{}}}, "interfaces", []string{"local_context_data"}},
+		{"primaryIp", concourse.Params{AllocateIp: &concourse.AllocateIp{Primary: true}}, "devices", []string{"primary_ip4", "primary_ip6"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := deviceWrittenFields(test.params, test.objectType)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestInterfaceWrittenFields(t *testing.T) {
+	mtu := int32(9000)
+	enabled := true
+
+	tests := []struct {
+		name       string
+		params     concourse.Params
+		objectType string
+		expected   []string
+	}{
+		{"deviceVersion", concourse.Params{CustomFields: map[string]any{"owner": "team-a"}}, "devices", []string{}},
+		{"customFields", concourse.Params{CustomFields: map[string]any{"owner": "team-a"}}, "interfaces", []string{"interface.custom_fields.owner"}},
+		{"interface", concourse.Params{Interface: &concourse.Interface{Enabled: &enabled, Mtu: &mtu, TaggedVlans: []int32{}}}, "interfaces", []string{"interface.enabled", "interface.mtu", "interface.tagged_vlans"}},
+		{"deviceFieldsOnly", concourse.Params{Status: "active"}, "interfaces", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := interfaceWrittenFields(test.params, test.objectType)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestCheckConflictUnguardedParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  concourse.Params
+		wantErr bool
+	}{
+		{"explicitFailWithApply", concourse.Params{Conflict: conflictFail, Apply: &concourse.Apply{}}, true},
+		{"explicitFailWithBulk", concourse.Params{Conflict: conflictFail, Bulk: &concourse.Bulk{}}, true},
+		{"defaultPolicyWithObjects", concourse.Params{Objects: &concourse.Objects{}}, false},
+		{"overwriteWithLldp", concourse.Params{Conflict: conflictOverwrite, Lldp: &concourse.Lldp{}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := CheckConflict(concourse.Input{Params: test.params}, context.Background())
+			if (err != nil) != test.wantErr {
+				t.Errorf("CheckConflict() error: '%v', error expected: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestConflictingFields(t *testing.T) {
+	changedFields := []FieldDiff{
+		{Field: "custom_fields.owner", Before: "team-a", After: "team-b"},
+		{Field: "serial", Before: "", After: "ABC123"},
+		{Field: "tags", Before: []any{}, After: []any{map[string]any{"slug": "maintenance"}}},
+	}
+	writtenFields := []string{"custom_fields.owner", "status", "tags"}
+
+	tests := []struct {
+		name     string
+		policy   string
+		expected []string
+	}{
+		{"fail", conflictFail, []string{"custom_fields.owner", "serial", "tags"}},
+		{"merge", conflictMerge, []string{"custom_fields.owner"}},
+		{"overwrite", conflictOverwrite, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := conflictingFields(changedFields, writtenFields, test.policy)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestExpandCustomFields(t *testing.T) {
+	diff := []FieldDiff{
+		{Field: "status", Before: "planned", After: "active"},
+		{Field: "custom_fields", Before: map[string]any{"owner": "team-a", "bios": "2.1"}, After: map[string]any{"owner": "team-b", "bios": "2.1", "rack_unit": 12.0}},
+	}
+	expected := []FieldDiff{
+		{Field: "custom_fields.owner", Before: "team-a", After: "team-b"},
+		{Field: "custom_fields.rack_unit", Before: nil, After: 12.0},
+		{Field: "status", Before: "planned", After: "active"},
+	}
+
+	result := expandCustomFields(diff)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func testInterface(id int32, name string, lastUpdated string) map[string]any {
+	return map[string]any{
+		"id": id, "url": "/api/dcim/interfaces/10/", "display": name, "name": name,
+		"device":     map[string]any{"id": 1, "url": "/api/dcim/devices/1/", "display": "server-1", "name": "server-1"},
+		"type":       map[string]any{"value": "1000base-t", "label": "1000BASE-T (1GE)"},
+		"link_peers": []any{}, "connected_endpoints_reachable": false, "count_ipaddresses": 0, "count_fhrp_groups": 0, "_occupied": false,
+		"last_updated": lastUpdated,
+	}
+}
+
+func TestCheckConflictInterfaceTimestamps(t *testing.T) {
+	tests := []struct {
+		name              string
+		deviceUpdated     string
+		interfaceUpdated  string
+		interfaceCurrent  string
+		expectedVersion   string
+		expectChangeQuery bool
+		wantErr           bool
+	}{
+		{"interfaceNewer", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z", "2025-01-01T11:00:00Z", "2025-01-01T11:00:00Z", false, false},
+		{"deviceNewer", "2025-01-01T12:00:00Z", "2025-01-01T11:00:00Z", "2025-01-01T11:00:00Z", "2025-01-01T12:00:00Z", false, false},
+		{"interfaceChangedAfterGet", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z", "2025-01-01T13:00:00Z", "2025-01-01T11:00:00Z", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				device netbox.DeviceWithConfigContext
+				iface  netbox.Interface
+			)
+
+			deviceData := testDevice(1, "server-1", map[string]any{})
+			deviceData["last_updated"] = test.deviceUpdated
+			for target, data := range map[any]map[string]any{&device: deviceData, &iface: testInterface(10, "eth0", test.interfaceUpdated)} {
+				dataBytes, err := json.Marshal(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal(dataBytes, target); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the version of check carries the later timestamp of the device and the interface
+			versions, err := populateInterfaceDetails("server-1", concourse.Input{}, device, []netbox.Interface{iface})
+			if err != nil || len(versions) != 1 {
+				t.Fatalf("populateInterfaceDetails() error: '%v', versions: %v", err, versions)
+			}
+			if versions[0].LastUpdated != test.expectedVersion {
+				t.Errorf("expected interface version %s, got %s", test.expectedVersion, versions[0].LastUpdated)
+			}
+
+			changeQuery := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/api/dcim/interfaces/10/":
+					_ = json.NewEncoder(w).Encode(testInterface(10, "eth0", test.interfaceCurrent))
+				case "/api/core/object-changes/":
+					changeQuery = true
+					_ = json.NewEncoder(w).Encode(map[string]any{"count": 0, "results": []any{}})
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			description := "uplink"
+			input := concourse.Input{Source: concourse.Source{Url: server.URL}, Version: versions[0], Params: concourse.Params{Interface: &concourse.Interface{Description: &description}}}
+			// without change log entries the changed last_updated is reported
+			if _, err := CheckConflict(input, context.Background()); (err != nil) != test.wantErr {
+				t.Fatalf("CheckConflict() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if changeQuery != test.expectChangeQuery {
+				t.Errorf("expected change log query %v, got %v", test.expectChangeQuery, changeQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+	"github.com/sapcc/concourse-netbox-resource/internal/filter"
+)
+
+type ObjectDetails struct {
+	Device      netbox.DeviceWithConfigContext
+	Interfaces  []netbox.Interface
+	IpAddresses []netbox.IPAddress
+}
+
+func FetchDetails(input concourse.Input, ctx context.Context) (ObjectDetails, error) {
+	var (
+		details ObjectDetails
+	)
+
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	deviceId, err := getDeviceId(input.Version)
+	if err != nil {
+		return ObjectDetails{}, err
+	}
+
+	details.Device, err = retrieveDevice(client, deviceId, ctx)
+	if err != nil {
+		return ObjectDetails{}, err
+	}
+
+	details.Interfaces, err = runPagedInterfaceQuery(client, filter.NetboxObject{}, deviceId, ctx)
+	if err != nil {
+		return ObjectDetails{}, fmt.Errorf("error during device interface query: %w", err)
+	}
+
+	details.IpAddresses, err = runPagedIpAddressQuery(client, deviceId, ctx)
+	if err != nil {
+		return ObjectDetails{}, fmt.Errorf("error during device ip address query: %w", err)
+	}
+	return details, nil
+}
+
+func ObjectExists(input concourse.Input, ctx context.Context) (bool, error) {
+	var (
+		response *http.Response
+	)
+
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	objectId, err := getObjectId(input.Version)
+	if err != nil {
+		return false, err
+	}
+
+	switch input.Version.ObjectType {
+	case "interfaces":
+		_, response, err = client.DcimAPI.DcimInterfacesRetrieve(ctx, objectId).Execute()
+	default:
+		_, response, err = client.DcimAPI.DcimDevicesRetrieve(ctx, objectId).Execute()
+	}
+	if response != nil && response.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error during %s retrieve query: %w", input.Version.ObjectType, err)
+	}
+	return true, nil
+}
+
+func (details ObjectDetails) TemplateData(version concourse.Version) (map[string]any, error) {
+	// convert to generic maps, so templates can use the field names of the NetBox API
+	data := map[string]any{}
+	for key, value := range map[string]any{
+		"version":      version,
+		"device":       details.Device,
+		"interfaces":   details.Interfaces,
+		"ip_addresses": details.IpAddresses,
+	} {
+		valueBytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s for template data: %w", key, err)
+		}
+		var generic any
+		if err := json.Unmarshal(valueBytes, &generic); err != nil {
+			return nil, fmt.Errorf("failed to decode %s for template data: %w", key, err)
+		}
+		data[key] = generic
+	}
+	data["config_context"] = details.Device.GetConfigContext()
+	return data, nil
+}
+
+func retrieveDevice(client *netbox.APIClient, deviceId int32, ctx context.Context) (netbox.DeviceWithConfigContext, error) {
+	device, _, err := client.DcimAPI.DcimDevicesRetrieve(ctx, deviceId).Execute()
+	if err != nil {
+		return netbox.DeviceWithConfigContext{}, fmt.Errorf("error during DcimDevicesRetrieve query: %w", err)
+	}
+	return *device, nil
+}
+
+func runPagedIpAddressQuery(client *netbox.APIClient, deviceId int32, ctx context.Context) ([]netbox.IPAddress, error) {
+	ipAddressList := make([]netbox.IPAddress, 0, 25)
+	limit := int32(25)
+	offset := int32(0)
+	for {
+		pagedQuery := client.IpamAPI.IpamIpAddressesList(ctx).DeviceId([]int32{deviceId}).Limit(limit).Offset(offset)
+		ipAddressQueryResponse, _, err := pagedQuery.Execute()
+		if err != nil {
+			return nil, fmt.Errorf("error during IpamIpAddressesList query: %w", err)
+		}
+		ipAddressList = append(ipAddressList, ipAddressQueryResponse.Results...)
+		if !ipAddressQueryResponse.Next.IsSet() || ipAddressQueryResponse.Next.Get() == nil || *ipAddressQueryResponse.Next.Get() == "" || len(ipAddressQueryResponse.Results) == 0 {
+			break
+		}
+		offset += limit
+	}
+	return ipAddressList, nil
+}
+
+func getDeviceId(version concourse.Version) (int32, error) {
+	id := version.Id
+	if version.ObjectType == "interfaces" {
+		id = version.DeviceId
+	}
+
+	deviceId, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid device id '%s' found in version: %w", id, err)
+	}
+	return int32(deviceId), nil
+}
+
+func getObjectId(version concourse.Version) (int32, error) {
+	objectId, err := strconv.ParseInt(version.Id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid object id '%s' found in version: %w", version.Id, err)
+	}
+	return int32(objectId), nil
+}
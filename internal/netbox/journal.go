@@ -0,0 +1,43 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func CreateJournalEntry(input concourse.Input, comment string, ctx context.Context) error {
+	request, err := createJournalEntryRequest(input.Version, input.Params.Journal.Kind, comment)
+	if err != nil {
+		return err
+	}
+
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+	return write(client, input.Params.DryRun, PlannedRequest{Method: http.MethodPost, Path: listPath("extras/journal-entries"), Body: request}, func() error {
+		_, _, err := client.ExtrasAPI.ExtrasJournalEntriesCreate(ctx).WritableJournalEntryRequest(request).Execute()
+		if err != nil {
+			return fmt.Errorf("error during ExtrasJournalEntriesCreate request: %w", err)
+		}
+		return nil
+	}, ctx)
+}
+
+func createJournalEntryRequest(version concourse.Version, kind string, comment string) (netbox.WritableJournalEntryRequest, error) {
+	objectId, err := getObjectId(version)
+	if err != nil {
+		return netbox.WritableJournalEntryRequest{}, err
+	}
+
+	request := netbox.NewWritableJournalEntryRequest(contentType(version.ObjectType), int64(objectId), comment)
+	if len(kind) > 0 {
+		kindValue, err := netbox.NewJournalEntryKindValueFromValue(kind)
+		if err != nil {
+			return netbox.WritableJournalEntryRequest{}, fmt.Errorf("invalid params.journal.kind: %w", err)
+		}
+		request.Kind = kindValue
+	}
+	return *request, nil
+}
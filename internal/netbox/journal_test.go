@@ -0,0 +1,42 @@
+package netbox
+
+import (
+	"testing"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestCreateJournalEntryRequest(t *testing.T) {
+	tests := []struct {
+		name               string
+		version            concourse.Version
+		kind               string
+		expectedObjectType string
+		expectedObjectId   int64
+		wantErr            bool
+	}{
+		{"deviceDefaultKind", concourse.Version{Id: "123", ObjectType: "devices"}, "", "dcim.device", 123, false},
+		{"deviceSuccess", concourse.Version{Id: "123", ObjectType: "devices"}, "success", "dcim.device", 123, false},
+		{"interfaceWarning", concourse.Version{Id: "456", ObjectType: "interfaces", DeviceId: "123"}, "warning", "dcim.interface", 456, false},
+		{"invalidKind", concourse.Version{Id: "123", ObjectType: "devices"}, "fatal", "", 0, true},
+		{"invalidId", concourse.Version{Id: "abc", ObjectType: "devices"}, "info", "", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := createJournalEntryRequest(test.version, test.kind, "deployed")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createJournalEntryRequest() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if request.AssignedObjectType != test.expectedObjectType || request.AssignedObjectId != test.expectedObjectId {
+				t.Errorf("expected %s %d, got %s %d", test.expectedObjectType, test.expectedObjectId, request.AssignedObjectType, request.AssignedObjectId)
+			}
+			if len(test.kind) > 0 && (request.Kind == nil || string(*request.Kind) != test.kind) {
+				t.Errorf("expected kind '%s', got %v", test.kind, request.Kind)
+			}
+		})
+	}
+}
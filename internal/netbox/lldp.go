@@ -0,0 +1,229 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+	"github.com/sapcc/concourse-netbox-resource/internal/filter"
+)
+
+const (
+	lldpMatch   string = "match"
+	lldpMissing string = "missing"
+	lldpWrong   string = "wrong"
+	lldpUnknown string = "unknown"
+)
+
+type CableMismatch struct {
+	Interface string `json:"interface"`
+	Kind      string `json:"kind"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual,omitempty"`
+	CableId   int32  `json:"cable_id,omitempty"`
+	Action    string `json:"action,omitempty"`
+	// the local interface is the a-side of created cables
+	interfaceId int32
+	neighbor    concourse.LldpNeighbor
+}
+
+func (mismatch CableMismatch) String() string {
+	line := fmt.Sprintf("%s %s: expected %s", mismatch.Kind, mismatch.Interface, mismatch.Expected)
+	if len(mismatch.Actual) > 0 {
+		line += ", found " + mismatch.Actual
+	}
+	if len(mismatch.Action) > 0 {
+		line += " (" + mismatch.Action + ")"
+	}
+	return line
+}
+
+func Lldp(input concourse.Input, ctx context.Context) ([]CableMismatch, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	lldp := input.Params.Lldp
+	if lldp == nil || len(lldp.Neighbors) == 0 {
+		return nil, fmt.Errorf("params.lldp requires neighbors in file or neighbors")
+	}
+	if len(lldp.MarkStatus) > 0 {
+		if _, err := netbox.NewCableStatusValueFromValue(lldp.MarkStatus); err != nil {
+			return nil, fmt.Errorf("invalid params.lldp.mark_status: %w", err)
+		}
+	}
+	markTags, err := lookupTag(client, lldp.MarkTag, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceId, err := getDeviceId(input.Version)
+	if err != nil {
+		return nil, err
+	}
+	device, err := retrieveDevice(client, deviceId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	interfaceList, err := runPagedInterfaceQuery(client, filter.NetboxObject{}, deviceId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := make([]map[string]any, 0, len(interfaceList))
+	for _, iface := range interfaceList {
+		fields, err := objectFields(iface)
+		if err != nil {
+			return nil, err
+		}
+		interfaces = append(interfaces, fields)
+	}
+
+	mismatches := compareLldp(device.GetName(), lldp.Neighbors, interfaces)
+	for i, mismatch := range mismatches {
+		switch {
+		case mismatch.Kind == lldpMissing && lldp.CreateCables:
+			mismatches[i].Action, err = createLldpCable(client, mismatch, input.Params.DryRun, ctx)
+		case mismatch.Kind == lldpWrong && (len(lldp.MarkStatus) > 0 || len(lldp.MarkTag) > 0):
+			mismatches[i].Action, err = markCable(client, mismatch.CableId, lldp.MarkStatus, markTags, input.Params.DryRun, ctx)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to reconcile cable of interface %s: %w", mismatch.Interface, err)
+		}
+	}
+	return mismatches, nil
+}
+
+// compareLldp compares the neighbors of the device with the connected endpoints, or the link peers if the cable path is incomplete
+func compareLldp(deviceName string, neighbors []concourse.LldpNeighbor, interfaces []map[string]any) []CableMismatch {
+	mismatches := []CableMismatch{}
+	for _, neighbor := range neighbors {
+		// discovery data may contain the neighbors of several devices
+		if len(neighbor.Device) > 0 && !sameName(neighbor.Device, deviceName) {
+			continue
+		}
+
+		mismatch := CableMismatch{Interface: neighbor.Interface, Expected: peerName(neighbor.RemoteDevice, neighbor.RemoteInterface), neighbor: neighbor}
+		index := slices.IndexFunc(interfaces, func(iface map[string]any) bool { return nestedValue(iface, "name") == neighbor.Interface })
+		if index < 0 {
+			mismatch.Kind = lldpUnknown
+			mismatches = append(mismatches, mismatch)
+			continue
+		}
+		iface := interfaces[index]
+		mismatch.interfaceId = int32(toFloat(nestedValue(iface, "id")))
+		mismatch.CableId = int32(toFloat(nestedValue(iface, "cable", "id")))
+
+		peers, _ := nestedValue(iface, "connected_endpoints").([]any)
+		if len(peers) == 0 {
+			peers, _ = nestedValue(iface, "link_peers").([]any)
+		}
+		actual := make([]string, 0, len(peers))
+		for _, peer := range peers {
+			remoteDevice, _ := nestedValue(peer, "device", "name").(string)
+			remoteInterface, _ := nestedValue(peer, "name").(string)
+			actual = append(actual, peerName(remoteDevice, remoteInterface))
+		}
+		mismatch.Actual = strings.Join(actual, ", ")
+
+		switch {
+		case mismatch.CableId == 0:
+			mismatch.Kind = lldpMissing
+		case slices.ContainsFunc(peers, func(peer any) bool {
+			remoteDevice, _ := nestedValue(peer, "device", "name").(string)
+			remoteInterface, _ := nestedValue(peer, "name").(string)
+			return sameName(remoteDevice, neighbor.RemoteDevice) && strings.EqualFold(remoteInterface, neighbor.RemoteInterface)
+		}):
+			mismatch.Kind = lldpMatch
+		default:
+			mismatch.Kind = lldpWrong
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	return mismatches
+}
+
+func createLldpCable(client *netbox.APIClient, mismatch CableMismatch, dryRun bool, ctx context.Context) (string, error) {
+	neighbor := mismatch.neighbor
+	remoteNames := []*string{&neighbor.RemoteDevice}
+	if shortName, _, found := strings.Cut(neighbor.RemoteDevice, "."); found {
+		remoteNames = append(remoteNames, &shortName)
+	}
+	remoteList, _, err := client.DcimAPI.DcimInterfacesList(ctx).Device(remoteNames).Name([]string{neighbor.RemoteInterface}).Execute()
+	if err != nil {
+		return "", fmt.Errorf("error during DcimInterfacesList query: %w", err)
+	}
+	if len(remoteList.Results) != 1 {
+		return "remote interface not found in NetBox", nil
+	}
+	remote := remoteList.Results[0]
+	if remote.Cable.IsSet() && remote.Cable.Get() != nil {
+		return "remote interface is already cabled", nil
+	}
+
+	fields := map[string]any{
+		"a_terminations": []map[string]any{{"object_type": "dcim.interface", "object_id": mismatch.interfaceId}},
+		"b_terminations": []map[string]any{{"object_type": "dcim.interface", "object_id": remote.Id}},
+		"status":         "connected",
+	}
+	err = write(client, dryRun, PlannedRequest{Method: http.MethodPost, Path: listPath("dcim/cables"), Body: fields}, func() error {
+		_, _, err := client.DcimAPI.DcimCablesCreate(ctx).WritableCableRequest(netbox.WritableCableRequest{AdditionalProperties: fields}).Execute()
+		if err != nil {
+			return fmt.Errorf("error during DcimCablesCreate request: %w", err)
+		}
+		return nil
+	}, ctx)
+	if err != nil {
+		return "", err
+	}
+	return "cable created", nil
+}
+
+func markCable(client *netbox.APIClient, cableId int32, status string, markTags []netbox.Tag, dryRun bool, ctx context.Context) (string, error) {
+	cable, _, err := client.DcimAPI.DcimCablesRetrieve(ctx, cableId).Execute()
+	if err != nil {
+		return "", fmt.Errorf("error during DcimCablesRetrieve query: %w", err)
+	}
+
+	fields := map[string]any{}
+	if len(status) > 0 && cable.Status.GetValue() != netbox.CableStatusValue(status) {
+		fields["status"] = status
+	}
+	if tags, changed := mergeTags(cable.Tags, markTags, nil); changed {
+		fields["tags"] = tags
+	}
+	if len(fields) == 0 {
+		return "cable already marked", nil
+	}
+
+	err = write(client, dryRun, PlannedRequest{Method: http.MethodPatch, Path: objectPath("dcim/cables", cableId), Body: fields}, func() error {
+		_, _, err := client.DcimAPI.DcimCablesPartialUpdate(ctx, cableId).PatchedWritableCableRequest(netbox.PatchedWritableCableRequest{AdditionalProperties: fields}).Execute()
+		if err != nil {
+			return fmt.Errorf("error during DcimCablesPartialUpdate request: %w", err)
+		}
+		return nil
+	}, ctx)
+	if err != nil {
+		return "", err
+	}
+	return "cable marked", nil
+}
+
+func peerName(device string, iface string) string {
+	return device + ":" + iface
+}
+
+// LLDP system names often contain the domain, which NetBox device names do not
+func sameName(a string, b string) bool {
+	shortName := func(name string) string {
+		name, _, _ = strings.Cut(name, ".")
+		return name
+	}
+	return strings.EqualFold(a, b) || strings.EqualFold(shortName(a), shortName(b))
+}
+
+func toFloat(value any) float64 {
+	number, _ := value.(float64)
+	return number
+}
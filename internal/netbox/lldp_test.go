@@ -0,0 +1,51 @@
+package netbox
+
+import (
+	"testing"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestCompareLldp(t *testing.T) {
+	peer := func(device string, name string) []any {
+		return []any{map[string]any{"device": map[string]any{"name": device}, "name": name}}
+	}
+	interfaces := []map[string]any{
+		{"id": float64(1), "name": "eth0", "cable": map[string]any{"id": float64(10)}, "connected_endpoints": peer("switch01", "Ethernet1/1"), "link_peers": peer("patch01", "front1")},
+		{"id": float64(2), "name": "eth1", "cable": map[string]any{"id": float64(11)}, "connected_endpoints": []any{}, "link_peers": peer("switch02", "Ethernet1/1")},
+		{"id": float64(3), "name": "eth2", "cable": nil},
+	}
+
+	tests := []struct {
+		name           string
+		neighbor       concourse.LldpNeighbor
+		expectedKind   string
+		expectedActual string
+		expectedCable  int32
+	}{
+		{"connectedEndpoint", concourse.LldpNeighbor{Interface: "eth0", RemoteDevice: "switch01.example.local", RemoteInterface: "ethernet1/1"}, lldpMatch, "switch01:Ethernet1/1", 10},
+		{"linkPeer", concourse.LldpNeighbor{Interface: "eth1", RemoteDevice: "switch02", RemoteInterface: "Ethernet1/1"}, lldpMatch, "switch02:Ethernet1/1", 11},
+		{"wrong", concourse.LldpNeighbor{Interface: "eth0", RemoteDevice: "switch03", RemoteInterface: "Ethernet1/1"}, lldpWrong, "switch01:Ethernet1/1", 10},
+		{"missing", concourse.LldpNeighbor{Interface: "eth2", RemoteDevice: "switch01", RemoteInterface: "Ethernet1/2"}, lldpMissing, "", 0},
+		{"unknown", concourse.LldpNeighbor{Interface: "eth9", RemoteDevice: "switch01", RemoteInterface: "Ethernet1/3"}, lldpUnknown, "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := compareLldp("server01", []concourse.LldpNeighbor{test.neighbor}, interfaces)
+			if len(result) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(result))
+			}
+			if result[0].Kind != test.expectedKind || result[0].Actual != test.expectedActual || result[0].CableId != test.expectedCable {
+				t.Errorf("expected %s, %s and cable %d, got %s, %s and cable %d", test.expectedKind, test.expectedActual, test.expectedCable, result[0].Kind, result[0].Actual, result[0].CableId)
+			}
+		})
+	}
+
+	t.Run("otherDevice", func(t *testing.T) {
+		result := compareLldp("server01", []concourse.LldpNeighbor{{Device: "server02", Interface: "eth0"}, {Device: "SERVER01.example.local", Interface: "eth0"}}, interfaces)
+		if len(result) != 1 {
+			t.Errorf("expected only the neighbors of server01, got %v", result)
+		}
+	})
+}
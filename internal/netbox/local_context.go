@@ -0,0 +1,308 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+const (
+	localContextReplace string = "replace"
+	localContextMerge   string = "merge"
+	localContextPatch   string = "patch"
+)
+
+func updateLocalContext(client *netbox.APIClient, deviceId int32, params concourse.LocalContext, ctx context.Context) (any, bool, error) {
+	device, err := retrieveDevice(client, deviceId, ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	current := normalizeValue(device.LocalContextData)
+	localContextData, err := mergeLocalContext(current, params)
+	if err != nil {
+		return nil, false, err
+	}
+	return localContextData, !reflect.DeepEqual(localContextData, current), nil
+}
+
+// updateVirtualMachineLocalContext patches the local config context data of the virtual machine selected by the params
+func updateVirtualMachineLocalContext(client *netbox.APIClient, params concourse.LocalContext, dryRun bool, ctx context.Context) error {
+	virtualMachineId, err := getVirtualMachineId(client, params, ctx)
+	if err != nil {
+		return err
+	}
+	virtualMachine, _, err := client.VirtualizationAPI.VirtualizationVirtualMachinesRetrieve(ctx, virtualMachineId).Execute()
+	if err != nil {
+		return fmt.Errorf("error during VirtualizationVirtualMachinesRetrieve query: %w", err)
+	}
+
+	current := normalizeValue(virtualMachine.LocalContextData)
+	localContextData, err := mergeLocalContext(current, params)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(localContextData, current) {
+		return nil
+	}
+
+	virtualMachineRequest := netbox.PatchedWritableVirtualMachineWithConfigContextRequest{AdditionalProperties: map[string]any{"local_context_data": localContextData}}
+	request := PlannedRequest{Method: http.MethodPatch, Path: objectPath("virtualization/virtual-machines", virtualMachineId), Body: virtualMachineRequest}
+	return write(client, dryRun, request, func() error {
+		_, _, err := client.VirtualizationAPI.VirtualizationVirtualMachinesPartialUpdate(ctx, virtualMachineId).PatchedWritableVirtualMachineWithConfigContextRequest(virtualMachineRequest).Execute()
+		if err != nil {
+			return fmt.Errorf("error during VirtualizationVirtualMachinesPartialUpdate request: %w", err)
+		}
+		return nil
+	}, ctx)
+}
+
+func getVirtualMachineId(client *netbox.APIClient, params concourse.LocalContext, ctx context.Context) (int32, error) {
+	if params.VirtualMachineId > 0 {
+		if len(params.VirtualMachine) > 0 {
+			return 0, fmt.Errorf("params.local_context accepts either virtual_machine or virtual_machine_id")
+		}
+		return params.VirtualMachineId, nil
+	}
+
+	virtualMachineList, _, err := client.VirtualizationAPI.VirtualizationVirtualMachinesList(ctx).Name([]string{params.VirtualMachine}).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("error during VirtualizationVirtualMachinesList query: %w", err)
+	}
+	if len(virtualMachineList.Results) != 1 {
+		return 0, fmt.Errorf("expected one virtual machine %s, found %d", params.VirtualMachine, len(virtualMachineList.Results))
+	}
+	return virtualMachineList.Results[0].Id, nil
+}
+
+// targetsVirtualMachine reports whether the local context is written to a virtual machine instead of the device of the version
+func targetsVirtualMachine(params concourse.LocalContext) bool {
+	return len(params.VirtualMachine) > 0 || params.VirtualMachineId > 0
+}
+
+func mergeLocalContext(current any, params concourse.LocalContext) (any, error) {
+	// without data a replace would silently clear the local context
+	if params.Data == nil {
+		return nil, fmt.Errorf("params.local_context requires file or data")
+	}
+	data := normalizeValue(params.Data)
+	switch params.Mode {
+	case "", localContextReplace:
+		return data, nil
+	case localContextMerge:
+		return deepMerge(current, data), nil
+	case localContextPatch:
+		operations, ok := data.([]any)
+		if !ok {
+			return nil, fmt.Errorf("params.local_context mode %s requires a list of JSON patch operations", localContextPatch)
+		}
+		return applyJsonPatch(current, operations)
+	default:
+		return nil, fmt.Errorf("invalid params.local_context.mode '%s', expected one of %s, %s or %s", params.Mode, localContextReplace, localContextMerge, localContextPatch)
+	}
+}
+
+// deepMerge follows the JSON merge patch semantics of RFC 7386, i.e. null values remove keys
+func deepMerge(current any, data any) any {
+	dataMap, ok := data.(map[string]any)
+	if !ok {
+		return data
+	}
+	currentMap, ok := current.(map[string]any)
+	if !ok {
+		currentMap = map[string]any{}
+	}
+
+	merged := maps.Clone(currentMap)
+	for key, value := range dataMap {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = deepMerge(merged[key], value)
+	}
+	return merged
+}
+
+// applyJsonPatch applies the operations of RFC 6902 to a copy of the document
+func applyJsonPatch(document any, operations []any) (any, error) {
+	document = normalizeValue(document)
+	for i, item := range operations {
+		operation, _ := item.(map[string]any)
+		op, _ := operation["op"].(string)
+		path, err := parsePointer(operation["path"])
+		if err != nil {
+			return nil, fmt.Errorf("JSON patch operation %d: %w", i, err)
+		}
+
+		switch op {
+		case "add":
+			document, err = patchAdd(document, path, operation["value"])
+		case "remove":
+			document, _, err = patchRemove(document, path)
+		case "replace":
+			if document, _, err = patchRemove(document, path); err == nil {
+				document, err = patchAdd(document, path, operation["value"])
+			}
+		case "move", "copy":
+			var (
+				from  []string
+				value any
+			)
+			if from, err = parsePointer(operation["from"]); err != nil {
+				break
+			}
+			if op == "move" {
+				document, value, err = patchRemove(document, from)
+			} else {
+				value, err = patchGet(document, from)
+				value = normalizeValue(value)
+			}
+			if err == nil {
+				document, err = patchAdd(document, path, value)
+			}
+		case "test":
+			var value any
+			if value, err = patchGet(document, path); err == nil && !reflect.DeepEqual(value, operation["value"]) {
+				err = fmt.Errorf("value at %v is %v, expected %v", operation["path"], value, operation["value"])
+			}
+		default:
+			err = fmt.Errorf("unsupported operation '%s'", op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("JSON patch operation %d: %w", i, err)
+		}
+	}
+	return document, nil
+}
+
+func parsePointer(value any) ([]string, error) {
+	pointer, ok := value.(string)
+	if !ok || (len(pointer) > 0 && !strings.HasPrefix(pointer, "/")) {
+		return nil, fmt.Errorf("invalid JSON pointer %v", value)
+	}
+	if len(pointer) == 0 {
+		return []string{}, nil
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func patchGet(document any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := document.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+			}
+			document = value
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			document = container[index]
+		default:
+			return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+		}
+	}
+	return document, nil
+}
+
+func patchAdd(document any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch container := document.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			container[path[0]] = value
+			return container, nil
+		}
+		child, ok := container[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+		}
+		child, err := patchAdd(child, path[1:], value)
+		container[path[0]] = child
+		return container, err
+	case []any:
+		if len(path) == 1 {
+			// "-" appends to the end of the array
+			if path[0] == "-" {
+				return append(container, value), nil
+			}
+			index, err := arrayIndex(path[0], len(container))
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(container, index, value), nil
+		}
+		index, err := arrayIndex(path[0], len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := patchAdd(container[index], path[1:], value)
+		container[index] = child
+		return container, err
+	default:
+		return nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+	}
+}
+
+func patchRemove(document any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, document, nil
+	}
+
+	switch container := document.(type) {
+	case map[string]any:
+		child, ok := container[path[0]]
+		if !ok {
+			return nil, nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+		}
+		if len(path) == 1 {
+			delete(container, path[0])
+			return container, child, nil
+		}
+		child, removed, err := patchRemove(child, path[1:])
+		container[path[0]] = child
+		return container, removed, err
+	case []any:
+		index, err := arrayIndex(path[0], len(container)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := container[index]
+			return slices.Delete(container, index, index+1), removed, nil
+		}
+		child, removed, err := patchRemove(container[index], path[1:])
+		container[index] = child
+		return container, removed, err
+	default:
+		return nil, nil, fmt.Errorf("path /%s not found", strings.Join(path, "/"))
+	}
+}
+
+func arrayIndex(token string, maxIndex int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > maxIndex || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %s", token)
+	}
+	return index, nil
+}
@@ -0,0 +1,147 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/netbox-community/go-netbox/v4"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestMergeLocalContext(t *testing.T) {
+	current := map[string]any{
+		"ntp":   map[string]any{"servers": []any{"10.0.0.1", "10.0.0.2"}, "prefer": "10.0.0.1"},
+		"owner": "team-a",
+	}
+
+	tests := []struct {
+		name     string
+		params   concourse.LocalContext
+		expected any
+		wantErr  bool
+	}{
+		{
+			"replace",
+			concourse.LocalContext{Data: map[string]any{"owner": "team-b"}},
+			map[string]any{"owner": "team-b"},
+			false,
+		},
+		{
+			"merge",
+			concourse.LocalContext{Mode: "merge", Data: map[string]any{"ntp": map[string]any{"prefer": nil, "servers": []any{"10.0.0.3"}}, "rack": 12}},
+			map[string]any{"ntp": map[string]any{"servers": []any{"10.0.0.3"}}, "owner": "team-a", "rack": 12.0},
+			false,
+		},
+		{
+			"patch",
+			concourse.LocalContext{Mode: "patch", Data: []any{
+				map[string]any{"op": "test", "path": "/owner", "value": "team-a"},
+				map[string]any{"op": "add", "path": "/ntp/servers/-", "value": "10.0.0.3"},
+				map[string]any{"op": "remove", "path": "/ntp/servers/0"},
+				map[string]any{"op": "replace", "path": "/ntp/prefer", "value": "10.0.0.2"},
+				map[string]any{"op": "move", "from": "/owner", "path": "/team"},
+				map[string]any{"op": "copy", "from": "/team", "path": "/ntp/owner"},
+			}},
+			map[string]any{"ntp": map[string]any{"servers": []any{"10.0.0.2", "10.0.0.3"}, "prefer": "10.0.0.2", "owner": "team-a"}, "team": "team-a"},
+			false,
+		},
+		{
+			"patchEscapedPointer",
+			concourse.LocalContext{Mode: "patch", Data: []any{map[string]any{"op": "add", "path": "/a~1b", "value": true}}},
+			map[string]any{"ntp": map[string]any{"servers": []any{"10.0.0.1", "10.0.0.2"}, "prefer": "10.0.0.1"}, "owner": "team-a", "a/b": true},
+			false,
+		},
+		{
+			"patchFailedTest",
+			concourse.LocalContext{Mode: "patch", Data: []any{map[string]any{"op": "test", "path": "/owner", "value": "team-b"}}},
+			nil,
+			true,
+		},
+		{
+			"patchMissingPath",
+			concourse.LocalContext{Mode: "patch", Data: []any{map[string]any{"op": "remove", "path": "/ntp/servers/5"}}},
+			nil,
+			true,
+		},
+		{
+			"patchRequiresList",
+			concourse.LocalContext{Mode: "patch", Data: map[string]any{"owner": "team-b"}},
+			nil,
+			true,
+		},
+		{
+			"missingData",
+			concourse.LocalContext{},
+			nil,
+			true,
+		},
+		{
+			"invalidMode",
+			concourse.LocalContext{Mode: "append", Data: map[string]any{}},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := mergeLocalContext(normalizeValue(current), test.params)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("mergeLocalContext() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestUpdateVirtualMachineLocalContext(t *testing.T) {
+	virtualMachine := map[string]any{"id": 7, "url": "/api/virtualization/virtual-machines/7/", "display": "vm-1", "name": "vm-1", "virtual_disk_count": 0,
+		"local_context_data": map[string]any{"owner": "team-a"}}
+
+	tests := []struct {
+		name     string
+		params   concourse.LocalContext
+		expected any
+	}{
+		{"byName", concourse.LocalContext{VirtualMachine: "vm-1", Mode: "merge", Data: map[string]any{"rack": 12}}, map[string]any{"owner": "team-a", "rack": 12.0}},
+		{"byId", concourse.LocalContext{VirtualMachineId: 7, Data: map[string]any{"owner": "team-b"}}, map[string]any{"owner": "team-b"}},
+		{"unchanged", concourse.LocalContext{VirtualMachineId: 7, Data: map[string]any{"owner": "team-a"}}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var patched map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/api/virtualization/virtual-machines/" && r.URL.Query().Get("name") == "vm-1":
+					_ = json.NewEncoder(w).Encode(map[string]any{"count": 1, "results": []any{virtualMachine}})
+				case r.Method == http.MethodGet && r.URL.Path == "/api/virtualization/virtual-machines/7/":
+					_ = json.NewEncoder(w).Encode(virtualMachine)
+				case r.Method == http.MethodPatch && r.URL.Path == "/api/virtualization/virtual-machines/7/":
+					_ = json.NewDecoder(r.Body).Decode(&patched)
+					_ = json.NewEncoder(w).Encode(virtualMachine)
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			client := netbox.NewAPIClientFor(server.URL, "")
+			if err := updateVirtualMachineLocalContext(client, test.params, false, context.Background()); err != nil {
+				t.Fatalf("updateVirtualMachineLocalContext() error: '%v'", err)
+			}
+			if !reflect.DeepEqual(patched["local_context_data"], test.expected) {
+				t.Errorf("expected local_context_data %v, got %v", test.expected, patched)
+			}
+		})
+	}
+}
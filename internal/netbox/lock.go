@@ -0,0 +1,204 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+var (
+	// NetBox has no compare-and-swap, so a claim is verified after concurrent claims had time to overwrite it
+	lockSettleTime time.Duration = 5 * time.Second
+)
+
+func Acquire(input concourse.Input, identity string, ctx context.Context) (concourse.Version, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	lock, err := validateLock(input.Source.Lock)
+	if err != nil {
+		return concourse.Version{}, err
+	}
+
+	deviceList, err := runPagedDeviceQuery(client, input.Source.Filter, ctx)
+	if err != nil {
+		return concourse.Version{}, fmt.Errorf("error during device query: %w", err)
+	}
+	candidates := filterClaimed(deviceList, lock, false)
+	if len(candidates) == 0 {
+		return concourse.Version{}, fmt.Errorf("no unclaimed device matches source.filter")
+	}
+
+	lockTags, err := lookupTag(client, lock.Tag, ctx)
+	if err != nil {
+		return concourse.Version{}, err
+	}
+
+	for _, candidate := range candidates {
+		// the list may be older than the verified claim of a concurrent build, so the claim is checked right before writing
+		device, err := retrieveDevice(client, candidate.Id, ctx)
+		if err != nil {
+			return concourse.Version{}, err
+		}
+		if len(lockOwner(device, lock)) > 0 {
+			continue
+		}
+
+		request := createLockPatch(device, lock, identity, lockTags)
+		err = write(client, input.Params.DryRun, PlannedRequest{Method: http.MethodPatch, Path: objectPath("dcim/devices", device.Id), Body: request}, func() error {
+			_, _, err := client.DcimAPI.DcimDevicesPartialUpdate(ctx, device.Id).PatchedWritableDeviceWithConfigContextRequest(request).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimDevicesPartialUpdate request: %w", err)
+			}
+			return nil
+		}, ctx)
+		if err != nil {
+			return concourse.Version{}, err
+		}
+		if input.Params.DryRun {
+			return deviceVersion(input.Source, device)
+		}
+
+		select {
+		case <-ctx.Done():
+			return concourse.Version{}, ctx.Err()
+		case <-time.After(lockSettleTime):
+		}
+
+		claimedDevice, err := retrieveDevice(client, device.Id, ctx)
+		if err != nil {
+			return concourse.Version{}, err
+		}
+		if lockOwner(claimedDevice, lock) == identity {
+			return deviceVersion(input.Source, claimedDevice)
+		}
+		// another build claimed the device concurrently, so the next candidate is tried
+	}
+	return concourse.Version{}, fmt.Errorf("all %d unclaimed devices matching source.filter were claimed concurrently", len(candidates))
+}
+
+func Release(input concourse.Input, identity string, ctx context.Context) (concourse.Version, error) {
+	version := input.Version
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	lock, err := validateLock(input.Source.Lock)
+	if err != nil {
+		return version, err
+	}
+
+	deviceId, err := getDeviceId(version)
+	if err != nil {
+		return version, err
+	}
+	device, err := retrieveDevice(client, deviceId, ctx)
+	if err != nil {
+		return version, err
+	}
+
+	owner := lockOwner(device, lock)
+	hasLockTag := slices.ContainsFunc(device.Tags, func(tag netbox.NestedTag) bool { return tag.Slug == lock.Tag })
+	if len(owner) == 0 && !hasLockTag {
+		return version, nil
+	}
+	if len(owner) > 0 && !samePipeline(owner, identity) && !input.Params.Force {
+		return version, fmt.Errorf("device %d is claimed by %s, set params.force to release the claim of another owner", deviceId, owner)
+	}
+
+	request := createLockPatch(device, lock, "", nil)
+	err = write(client, input.Params.DryRun, PlannedRequest{Method: http.MethodPatch, Path: objectPath("dcim/devices", deviceId), Body: request}, func() error {
+		device, _, err := client.DcimAPI.DcimDevicesPartialUpdate(ctx, deviceId).PatchedWritableDeviceWithConfigContextRequest(request).Execute()
+		if err != nil {
+			return fmt.Errorf("error during DcimDevicesPartialUpdate request: %w", err)
+		}
+		version = updatedVersion(version, device.LastUpdated.Get())
+		return nil
+	}, ctx)
+	return version, err
+}
+
+// claims are usually acquired and released by different jobs of a pipeline, so the job and build of the owner are ignored
+func samePipeline(owner string, identity string) bool {
+	pipeline := func(buildUrl string) string {
+		parsed, err := url.Parse(buildUrl)
+		if err != nil || len(parsed.Host) == 0 {
+			return buildUrl
+		}
+		parsed.Path, _, _ = strings.Cut(parsed.Path, "/jobs/")
+		return parsed.String()
+	}
+	return owner == identity || pipeline(owner) == pipeline(identity)
+}
+
+func validateLock(lock *concourse.Lock) (concourse.Lock, error) {
+	if lock == nil || len(lock.CustomField) == 0 {
+		return concourse.Lock{}, fmt.Errorf("source.lock.custom_field is required to claim devices")
+	}
+	return *lock, nil
+}
+
+func lookupTag(client *netbox.APIClient, slug string, ctx context.Context) ([]netbox.Tag, error) {
+	if len(slug) == 0 {
+		return nil, nil
+	}
+
+	tagList, _, err := client.ExtrasAPI.ExtrasTagsList(ctx).Slug([]string{slug}).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error during ExtrasTagsList query: %w", err)
+	}
+	if len(tagList.Results) != 1 {
+		return nil, fmt.Errorf("tag %s is not defined in NetBox", slug)
+	}
+	return tagList.Results, nil
+}
+
+// an empty identity releases the claim
+func createLockPatch(device netbox.DeviceWithConfigContext, lock concourse.Lock, identity string, lockTags []netbox.Tag) netbox.PatchedWritableDeviceWithConfigContextRequest {
+	var (
+		request netbox.PatchedWritableDeviceWithConfigContextRequest
+		owner   any
+	)
+
+	if len(identity) > 0 {
+		owner = identity
+	}
+	request.CustomFields = map[string]any{lock.CustomField: owner}
+
+	if len(lock.Tag) > 0 {
+		removeTags := []string{}
+		if len(identity) == 0 {
+			removeTags = append(removeTags, lock.Tag)
+		}
+		if tags, changed := mergeTags(device.Tags, lockTags, removeTags); changed {
+			request.Tags = tags
+		}
+	}
+	return request
+}
+
+func lockOwner(device netbox.DeviceWithConfigContext, lock concourse.Lock) string {
+	owner, _ := device.CustomFields[lock.CustomField].(string)
+	return owner
+}
+
+func filterClaimed(deviceList []netbox.DeviceWithConfigContext, lock concourse.Lock, claimed bool) []netbox.DeviceWithConfigContext {
+	return slices.DeleteFunc(slices.Clone(deviceList), func(device netbox.DeviceWithConfigContext) bool {
+		return (len(lockOwner(device, lock)) > 0) != claimed
+	})
+}
+
+func deviceVersion(source concourse.Source, device netbox.DeviceWithConfigContext) (concourse.Version, error) {
+	versions, err := populateDeviceDetails(device.GetName(), concourse.Input{Source: source}, device)
+	if err != nil {
+		return concourse.Version{}, err
+	}
+	if len(versions) != 1 {
+		return concourse.Version{}, fmt.Errorf("failed to create version of device %d", device.Id)
+	}
+	return versions[0], nil
+}
@@ -0,0 +1,302 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestFilterClaimed(t *testing.T) {
+	lock := concourse.Lock{CustomField: "concourse_lock"}
+	deviceList := []netbox.DeviceWithConfigContext{
+		{Id: 1, CustomFields: map[string]any{"concourse_lock": "https://ci.example.local/builds/1"}},
+		{Id: 2, CustomFields: map[string]any{"concourse_lock": nil}},
+		{Id: 3, CustomFields: map[string]any{"concourse_lock": ""}},
+		{Id: 4},
+	}
+
+	tests := []struct {
+		name     string
+		claimed  bool
+		expected []int32
+	}{
+		{"claimed", true, []int32{1}},
+		{"unclaimed", false, []int32{2, 3, 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := []int32{}
+			for _, device := range filterClaimed(deviceList, lock, test.claimed) {
+				result = append(result, device.Id)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+			if len(deviceList) != 4 {
+				t.Errorf("expected the device list to be unchanged, got %d devices", len(deviceList))
+			}
+		})
+	}
+}
+
+func TestCreateLockPatch(t *testing.T) {
+	device := netbox.DeviceWithConfigContext{Tags: []netbox.NestedTag{{Name: "server", Slug: "server"}, {Name: "locked", Slug: "locked"}}}
+	unlockedDevice := netbox.DeviceWithConfigContext{Tags: []netbox.NestedTag{{Name: "server", Slug: "server"}}}
+	lockTags := []netbox.Tag{{Name: "locked", Slug: "locked"}}
+
+	tests := []struct {
+		name          string
+		device        netbox.DeviceWithConfigContext
+		lock          concourse.Lock
+		identity      string
+		expectedOwner any
+		expectedTags  []string
+	}{
+		{"acquire", unlockedDevice, concourse.Lock{CustomField: "concourse_lock", Tag: "locked"}, "build 42", "build 42", []string{"server", "locked"}},
+		{"acquireTagged", device, concourse.Lock{CustomField: "concourse_lock", Tag: "locked"}, "build 42", "build 42", nil},
+		{"acquireWithoutTag", unlockedDevice, concourse.Lock{CustomField: "concourse_lock"}, "build 42", "build 42", nil},
+		{"release", device, concourse.Lock{CustomField: "concourse_lock", Tag: "locked"}, "", nil, []string{"server"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags := lockTags
+			if len(test.identity) == 0 {
+				tags = nil
+			}
+			request := createLockPatch(test.device, test.lock, test.identity, tags)
+			if owner := request.CustomFields[test.lock.CustomField]; owner != test.expectedOwner {
+				t.Errorf("expected owner %v, got %v", test.expectedOwner, owner)
+			}
+
+			var resultTags []string
+			for _, tag := range request.Tags {
+				resultTags = append(resultTags, tag.Slug)
+			}
+			if !reflect.DeepEqual(resultTags, test.expectedTags) {
+				t.Errorf("expected tags %v, got %v", test.expectedTags, resultTags)
+			}
+		})
+	}
+}
+
+func TestSamePipeline(t *testing.T) {
+	identity := "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/release/builds/7"
+
+	tests := []struct {
+		name     string
+		owner    string
+		expected bool
+	}{
+		{"sameBuild", identity, true},
+		{"otherJob", "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/acquire/builds/3", true},
+		{"otherPipeline", "https://concourse.example.local/teams/main/pipelines/other/jobs/acquire/builds/3", false},
+		{"otherInstance", "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/acquire/builds/3?vars=%7B%22dc%22%3A%22b%22%7D", false},
+		{"manualOwner", "jane", false},
+		{"oneOffBuild", "build 1234", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := samePipeline(test.owner, identity); result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+// deviceServer serves the devices of a NetBox stub, patches are recorded and update the custom fields and last_updated
+type deviceServer struct {
+	mu      sync.Mutex
+	devices map[int32]map[string]any
+	patches map[int32][]map[string]any
+	// onPatch is called after a patch was applied, e.g. to simulate a concurrent write
+	onPatch func(id int32, device map[string]any)
+	updated string
+}
+
+func newDeviceServer(t *testing.T, devices ...map[string]any) (*deviceServer, *httptest.Server) {
+	stub := &deviceServer{devices: map[int32]map[string]any{}, patches: map[int32][]map[string]any{}, updated: "2025-02-01T10:00:00Z"}
+	for _, device := range devices {
+		stub.devices[device["id"].(int32)] = device
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet && r.URL.Path == "/api/dcim/devices/" {
+			results := []any{}
+			for _, id := range slices.Sorted(maps.Keys(stub.devices)) {
+				results = append(results, stub.devices[id])
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"count": len(results), "results": results})
+			return
+		}
+
+		idValue, ok := strings.CutPrefix(r.URL.Path, "/api/dcim/devices/")
+		id, err := strconv.Atoi(strings.TrimSuffix(idValue, "/"))
+		device, found := stub.devices[int32(id)]
+		if !ok || err != nil || !found {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPatch:
+			var patch map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				t.Errorf("failed to decode patch: %v", err)
+			}
+			stub.patches[int32(id)] = append(stub.patches[int32(id)], patch)
+			if customFields, ok := patch["custom_fields"].(map[string]any); ok {
+				maps.Copy(device["custom_fields"].(map[string]any), customFields)
+			}
+			device["last_updated"] = stub.updated
+			if stub.onPatch != nil {
+				stub.onPatch(int32(id), device)
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(device)
+	}))
+	return stub, server
+}
+
+func testDevice(id int32, name string, customFields map[string]any) map[string]any {
+	return map[string]any{
+		"id": id, "url": fmt.Sprintf("/api/dcim/devices/%d/", id), "display": name, "name": name,
+		"device_type": map[string]any{"id": 1, "url": "/api/dcim/device-types/1/", "display": "server", "model": "server", "slug": "server",
+			"manufacturer": map[string]any{"id": 1, "url": "/api/dcim/manufacturers/1/", "display": "acme", "name": "acme", "slug": "acme"}},
+		"role":               map[string]any{"id": 1, "url": "/api/dcim/device-roles/1/", "display": "server", "name": "server", "slug": "server"},
+		"site":               map[string]any{"id": 1, "url": "/api/dcim/sites/1/", "display": "site-a", "name": "site-a", "slug": "site-a"},
+		"console_port_count": 0, "console_server_port_count": 0, "power_port_count": 0, "power_outlet_count": 0, "front_port_count": 0,
+		"rear_port_count": 0, "device_bay_count": 0, "module_bay_count": 0, "inventory_item_count": 0,
+		"tags": []any{}, "custom_fields": customFields, "last_updated": "2025-01-01T00:00:00Z",
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	identity := "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/acquire/builds/7"
+	concurrent := "https://concourse.example.local/teams/main/pipelines/other/jobs/acquire/builds/3"
+
+	tests := []struct {
+		name     string
+		owners   []any
+		lostRace []int32
+		expected string
+		patched  []int32
+		wantErr  bool
+	}{
+		{"claimUnclaimed", []any{concurrent, nil}, nil, "2", []int32{2}, false},
+		{"lostRace", []any{nil, nil}, []int32{1}, "2", []int32{1, 2}, false},
+		{"allLost", []any{nil, nil}, []int32{1, 2}, "", []int32{1, 2}, true},
+		{"allClaimed", []any{concurrent, concurrent}, nil, "", []int32{}, true},
+	}
+
+	defer func(settleTime time.Duration) { lockSettleTime = settleTime }(lockSettleTime)
+	lockSettleTime = 0
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			devices := []map[string]any{}
+			for i, owner := range test.owners {
+				devices = append(devices, testDevice(int32(i+1), fmt.Sprintf("server-%d", i+1), map[string]any{"lock_owner": owner}))
+			}
+			stub, server := newDeviceServer(t, devices...)
+			defer server.Close()
+			// a concurrent build overwrites the claim before it is verified
+			stub.onPatch = func(id int32, device map[string]any) {
+				if slices.Contains(test.lostRace, id) {
+					device["custom_fields"].(map[string]any)["lock_owner"] = concurrent
+				}
+			}
+
+			input := concourse.Input{Source: concourse.Source{Url: server.URL, Lock: &concourse.Lock{CustomField: "lock_owner"}}}
+			version, err := Acquire(input, identity, context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Acquire() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if version.Id != test.expected {
+				t.Errorf("expected device %q, got %+v", test.expected, version)
+			}
+			if !test.wantErr && (version.ObjectType != "devices" || version.LastUpdated != stub.updated) {
+				t.Errorf("expected device version of the verified claim, got %+v", version)
+			}
+			patched := slices.Sorted(maps.Keys(stub.patches))
+			if !slices.Equal(patched, test.patched) {
+				t.Errorf("expected patched devices %v, got %v", test.patched, patched)
+			}
+			for id, patches := range stub.patches {
+				if owner := patches[0]["custom_fields"].(map[string]any)["lock_owner"]; owner != identity {
+					t.Errorf("expected claim of device %d by %s, got %v", id, identity, owner)
+				}
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	identity := "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/release/builds/8"
+
+	tests := []struct {
+		name    string
+		owner   any
+		force   bool
+		patched bool
+		wantErr bool
+	}{
+		{"ownerPipeline", "https://concourse.example.local/teams/main/pipelines/provisioning/jobs/acquire/builds/7", false, true, false},
+		{"otherPipeline", "https://concourse.example.local/teams/main/pipelines/other/jobs/acquire/builds/3", false, false, true},
+		{"otherPipelineForced", "https://concourse.example.local/teams/main/pipelines/other/jobs/acquire/builds/3", true, true, false},
+		{"unclaimed", nil, false, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub, server := newDeviceServer(t, testDevice(1, "server-1", map[string]any{"lock_owner": test.owner}))
+			defer server.Close()
+
+			input := concourse.Input{
+				Source:  concourse.Source{Url: server.URL, Lock: &concourse.Lock{CustomField: "lock_owner"}},
+				Version: concourse.Version{Id: "1", LastUpdated: "2025-01-01T00:00:00Z", ObjectType: "devices"},
+				Params:  concourse.Params{Release: true, Force: test.force},
+			}
+			version, err := Release(input, identity, context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Release() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			patches := stub.patches[1]
+			if (len(patches) > 0) != test.patched {
+				t.Fatalf("expected patch %v, got %v", test.patched, patches)
+			}
+			if test.patched {
+				if owner, ok := patches[0]["custom_fields"].(map[string]any)["lock_owner"]; !ok || owner != nil {
+					t.Errorf("expected the claim to be cleared, got %v", patches[0])
+				}
+				if version.LastUpdated != stub.updated {
+					t.Errorf("expected last_updated %s of the release, got %+v", stub.updated, version)
+				}
+			}
+		})
+	}
+}
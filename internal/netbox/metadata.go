@@ -0,0 +1,89 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func Metadata(input concourse.Input, ctx context.Context) ([]concourse.Metadata, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	deviceId, err := getDeviceId(input.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := retrieveDevice(client, deviceId, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lastChangedBy, err := getLastChangedBy(client, input.Version, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return createMetadata(input.Version, device, lastChangedBy), nil
+}
+
+func createMetadata(version concourse.Version, device netbox.DeviceWithConfigContext, lastChangedBy string) []concourse.Metadata {
+	metadata := []concourse.Metadata{
+		{Name: "device_name", Value: device.GetName()},
+		{Name: "site", Value: device.Site.GetName()},
+		{Name: "role", Value: device.Role.GetName()},
+	}
+	if device.Status != nil && device.Status.Value != nil {
+		metadata = append(metadata, concourse.Metadata{Name: "status", Value: string(*device.Status.Value)})
+	}
+	if primaryIp, ok := device.GetPrimaryIpOk(); ok && primaryIp != nil {
+		metadata = append(metadata, concourse.Metadata{Name: "primary_ip", Value: primaryIp.GetAddress()})
+	}
+	if platform, ok := device.GetPlatformOk(); ok && platform != nil {
+		metadata = append(metadata, concourse.Metadata{Name: "platform", Value: platform.GetName()})
+	}
+	if device.DisplayUrl != nil {
+		metadata = append(metadata, concourse.Metadata{Name: "display_url", Value: *device.DisplayUrl})
+	}
+	if version.ObjectType == "interfaces" {
+		metadata = append(metadata, concourse.Metadata{Name: "interface_name", Value: version.InterfaceName})
+		if len(version.InterfaceDisplayUrl) > 0 {
+			metadata = append(metadata, concourse.Metadata{Name: "interface_display_url", Value: version.InterfaceDisplayUrl})
+		}
+	}
+	if len(lastChangedBy) > 0 {
+		metadata = append(metadata, concourse.Metadata{Name: "last_changed_by", Value: lastChangedBy})
+	}
+	return metadata
+}
+
+func getLastChangedBy(client *netbox.APIClient, version concourse.Version, ctx context.Context) (string, error) {
+	objectId, err := getObjectId(version)
+	if err != nil {
+		return "", err
+	}
+
+	changeList, _, err := client.CoreAPI.CoreObjectChangesList(ctx).
+		ChangedObjectType(contentType(version.ObjectType)).
+		ChangedObjectId([]int32{objectId}).
+		Ordering("-time").
+		Limit(1).
+		Execute()
+	if err != nil {
+		return "", fmt.Errorf("error during CoreObjectChangesList query: %w", err)
+	}
+	if len(changeList.Results) == 0 {
+		return "", nil
+	}
+	return changeList.Results[0].UserName, nil
+}
+
+func contentType(objectType string) string {
+	switch objectType {
+	case "interfaces":
+		return "dcim.interface"
+	default:
+		return "dcim.device"
+	}
+}
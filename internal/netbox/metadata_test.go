@@ -0,0 +1,81 @@
+package netbox
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+	"github.com/sapcc/concourse-netbox-resource/internal/helper"
+)
+
+func TestCreateMetadata(t *testing.T) {
+	var (
+		site     netbox.BriefSite
+		platform netbox.BriefPlatform
+		status   netbox.DeviceStatus
+	)
+
+	metadataDevice := netbox.NewDeviceWithConfigContextWithDefaults()
+	metadataDevice.Id = helper.DeviceId
+	metadataDevice.SetName(helper.DeviceName)
+	displayUrl := helper.DeviceDisplayUrl + fmt.Sprintf("/%d/", helper.DeviceId)
+	metadataDevice.DisplayUrl = &displayUrl
+	site.SetName("site-a")
+	metadataDevice.Site = site
+	metadataDevice.Role.SetName("Server")
+	status.SetValue(netbox.DEVICESTATUSVALUE_ACTIVE)
+	metadataDevice.Status = &status
+	platform.SetName("linux")
+	metadataDevice.SetPlatform(platform)
+
+	tests := []struct {
+		name          string
+		version       concourse.Version
+		lastChangedBy string
+		expected      map[string]string
+	}{
+		{
+			"device",
+			concourse.Version{ObjectType: "devices"},
+			"admin",
+			map[string]string{
+				"device_name":     helper.DeviceName,
+				"site":            "site-a",
+				"role":            "Server",
+				"status":          "active",
+				"platform":        "linux",
+				"display_url":     displayUrl,
+				"last_changed_by": "admin",
+			},
+		},
+		{
+			"interfaceWithoutChanges",
+			concourse.Version{ObjectType: "interfaces", InterfaceName: "eth0"},
+			"",
+			map[string]string{
+				"device_name":    helper.DeviceName,
+				"site":           "site-a",
+				"role":           "Server",
+				"status":         "active",
+				"platform":       "linux",
+				"display_url":    displayUrl,
+				"interface_name": "eth0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := createMetadata(test.version, *metadataDevice, test.lastChangedBy)
+			if len(result) != len(test.expected) {
+				t.Errorf("expected %d metadata entries, got %d: %v", len(test.expected), len(result), result)
+			}
+			for _, entry := range result {
+				if test.expected[entry.Name] != entry.Value {
+					t.Errorf("expected %s to be '%s', got '%s'", entry.Name, test.expected[entry.Name], entry.Value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+var (
+	// children are deleted before their parents
+	deleteOrder = []string{"ip-addresses", "interfaces", "devices"}
+)
+
+func Objects(input concourse.Input, ctx context.Context) ([]PlannedChange, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	objects := input.Params.Objects
+	if objects == nil || objects.Spec == nil {
+		return nil, fmt.Errorf("params.objects requires a spec in file or spec")
+	}
+	createState := concourse.State{Devices: objects.Spec.Create}
+	if err := validateState(createState); err != nil {
+		return nil, err
+	}
+	if err := validateObjectRefs(objects.Spec.Delete); err != nil {
+		return nil, err
+	}
+	if len(objects.Spec.Delete) > 0 && len(objects.ConfirmTag) == 0 {
+		return nil, fmt.Errorf("deleting objects requires params.objects.confirm_tag")
+	}
+
+	references, err := loadApplyReferences(client, createState, ctx)
+	if err != nil {
+		return nil, err
+	}
+	current, err := loadCurrentState(client, concourse.Apply{State: &createState}, ctx)
+	if err != nil {
+		return nil, err
+	}
+	createPlan, err := planState(createState, current, references, false)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteState := concourse.State{}
+	for _, ref := range objects.Spec.Delete {
+		deleteState.Devices = append(deleteState.Devices, concourse.StateDevice{Site: ref.Site, Name: ref.Device})
+	}
+	deleteCurrent, err := loadCurrentState(client, concourse.Apply{State: &deleteState}, ctx)
+	if err != nil {
+		return nil, err
+	}
+	deletes, err := planObjectDeletes(objects.Spec.Delete, deleteCurrent, objects.ConfirmTag)
+	if err != nil {
+		return nil, err
+	}
+	if len(deletes) > objects.MaxDeletes {
+		return nil, fmt.Errorf("%d objects would be deleted, but params.objects.max_deletes allows %d", len(deletes), objects.MaxDeletes)
+	}
+
+	// existing objects of the create spec are left untouched
+	plan := slices.DeleteFunc(createPlan, func(change PlannedChange) bool { return change.Action != applyCreate })
+	plan = append(plan, deletes...)
+
+	return executePlan(client, plan, currentIds(current), input.Params.DryRun, ctx)
+}
+
+func validateObjectRefs(refs []concourse.ObjectRef) error {
+	for _, ref := range refs {
+		if len(ref.Site) == 0 || len(ref.Device) == 0 {
+			return fmt.Errorf("objects to delete require site and device")
+		}
+		if len(ref.Address) > 0 && len(ref.Interface) == 0 {
+			return fmt.Errorf("IP address %s to delete requires the interface it is assigned to", ref.Address)
+		}
+	}
+	return nil
+}
+
+// planObjectDeletes refuses the whole plan, if any object fails the guards. NetBox deletes the interfaces of a device and the
+// IP addresses of an interface with it, so they are planned and guarded like listed objects.
+func planObjectDeletes(refs []concourse.ObjectRef, current map[string]currentObject, confirmTag string) ([]PlannedChange, error) {
+	deletes := []PlannedChange{}
+	for _, ref := range refs {
+		key := deviceKey(ref.Site, ref.Device)
+		device, ok := current[key]
+		// objects deleted by a previous run are skipped
+		if !ok {
+			continue
+		}
+
+		objectType, object := "devices", device
+		if len(ref.Interface) > 0 {
+			objectType, key = "interfaces", childKey(key, ref.Interface)
+			if object, ok = device.Children[ref.Interface]; !ok {
+				continue
+			}
+		}
+		if len(ref.Address) > 0 {
+			objectType, key = "ip-addresses", childKey(key, ref.Address)
+			if object, ok = object.Children[ref.Address]; !ok {
+				continue
+			}
+		}
+
+		var err error
+		deletes, err = planObjectDelete(deletes, objectType, key, object, device, confirmTag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortStableFunc(deletes, func(a PlannedChange, b PlannedChange) int {
+		return slices.Index(deleteOrder, a.ObjectType) - slices.Index(deleteOrder, b.ObjectType)
+	})
+	return deletes, nil
+}
+
+func planObjectDelete(deletes []PlannedChange, objectType string, key string, object currentObject, device currentObject, confirmTag string) ([]PlannedChange, error) {
+	if !slices.Contains(tagSlugs(object.Fields), confirmTag) {
+		return nil, fmt.Errorf("refusing to delete %s %s without the confirmation tag %s", objectType, key, confirmTag)
+	}
+	// interfaces have no status of their own, so the status of their device applies
+	statusFields := object.Fields
+	if objectType == "interfaces" {
+		statusFields = device.Fields
+	}
+	if nestedValue(statusFields, "status", "value") == "active" {
+		return nil, fmt.Errorf("refusing to delete %s %s with active status", objectType, key)
+	}
+
+	if !slices.ContainsFunc(deletes, func(change PlannedChange) bool { return change.Key == key }) {
+		deletes = append(deletes, PlannedChange{Action: applyDelete, ObjectType: objectType, Key: key, Id: object.Id})
+	}
+
+	childType := map[string]string{"devices": "interfaces", "interfaces": "ip-addresses"}[objectType]
+	for _, name := range slices.Sorted(maps.Keys(object.Children)) {
+		var err error
+		deletes, err = planObjectDelete(deletes, childType, childKey(key, name), object.Children[name], device, confirmTag)
+		if err != nil {
+			return nil, fmt.Errorf("%w, which would be deleted with %s %s", err, objectType, key)
+		}
+	}
+	return deletes, nil
+}
@@ -0,0 +1,218 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestPlanObjectDeletes(t *testing.T) {
+	confirmed := []any{map[string]any{"slug": "decommission-approved"}}
+	current := map[string]currentObject{
+		"site-a/server01": {
+			Id:     10,
+			Fields: map[string]any{"status": map[string]any{"value": "decommissioning"}, "tags": confirmed},
+			Children: map[string]currentObject{
+				"eth0": {
+					Id:     20,
+					Fields: map[string]any{"tags": confirmed},
+					Children: map[string]currentObject{
+						"10.0.0.5/24": {Id: 30, Fields: map[string]any{"status": map[string]any{"value": "deprecated"}, "tags": confirmed}},
+						"10.0.0.6/24": {Id: 31, Fields: map[string]any{"status": map[string]any{"value": "active"}, "tags": confirmed}},
+					},
+				},
+				"eth1": {Id: 21, Fields: map[string]any{}},
+			},
+		},
+		"site-a/server03": {
+			Id:     12,
+			Fields: map[string]any{"status": map[string]any{"value": "offline"}, "tags": confirmed},
+			Children: map[string]currentObject{
+				"eth0": {
+					Id:     23,
+					Fields: map[string]any{"tags": confirmed},
+					Children: map[string]currentObject{
+						"10.0.1.5/24": {Id: 32, Fields: map[string]any{"status": map[string]any{"value": "deprecated"}, "tags": confirmed}},
+					},
+				},
+				"eth1": {Id: 24, Fields: map[string]any{"tags": confirmed}},
+			},
+		},
+		"site-a/server02": {
+			Id:     11,
+			Fields: map[string]any{"status": map[string]any{"value": "active"}, "tags": confirmed},
+			Children: map[string]currentObject{
+				"eth0": {Id: 22, Fields: map[string]any{"tags": confirmed}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		refs     []concourse.ObjectRef
+		expected []PlannedChange
+		wantErr  bool
+	}{
+		{
+			name: "childrenBeforeParents",
+			refs: []concourse.ObjectRef{
+				{Site: "site-a", Device: "server03"},
+				{Site: "site-a", Device: "server03", Interface: "eth0"},
+				{Site: "site-a", Device: "server03", Interface: "eth0", Address: "10.0.1.5/24"},
+			},
+			expected: []PlannedChange{
+				{Action: applyDelete, ObjectType: "ip-addresses", Key: "site-a/server03/eth0/10.0.1.5/24", Id: 32},
+				{Action: applyDelete, ObjectType: "interfaces", Key: "site-a/server03/eth0", Id: 23},
+				{Action: applyDelete, ObjectType: "interfaces", Key: "site-a/server03/eth1", Id: 24},
+				{Action: applyDelete, ObjectType: "devices", Key: "site-a/server03", Id: 12},
+			},
+		},
+		{
+			name: "missingObjectsAndDuplicates",
+			refs: []concourse.ObjectRef{
+				{Site: "site-a", Device: "server03", Interface: "eth0"},
+				{Site: "site-a", Device: "server03", Interface: "eth0"},
+				{Site: "site-a", Device: "server04"},
+				{Site: "site-a", Device: "server03", Interface: "eth9"},
+			},
+			expected: []PlannedChange{
+				{Action: applyDelete, ObjectType: "ip-addresses", Key: "site-a/server03/eth0/10.0.1.5/24", Id: 32},
+				{Action: applyDelete, ObjectType: "interfaces", Key: "site-a/server03/eth0", Id: 23},
+			},
+		},
+		{
+			name: "ipAddress",
+			refs: []concourse.ObjectRef{{Site: "site-a", Device: "server01", Interface: "eth0", Address: "10.0.0.5/24"}},
+			expected: []PlannedChange{
+				{Action: applyDelete, ObjectType: "ip-addresses", Key: "site-a/server01/eth0/10.0.0.5/24", Id: 30},
+			},
+		},
+		{
+			name:    "cascadedInterfaceWithoutConfirmTag",
+			refs:    []concourse.ObjectRef{{Site: "site-a", Device: "server01"}},
+			wantErr: true,
+		},
+		{
+			name:    "cascadedActiveIpAddress",
+			refs:    []concourse.ObjectRef{{Site: "site-a", Device: "server01", Interface: "eth0"}},
+			wantErr: true,
+		},
+		{
+			name:    "missingConfirmTag",
+			refs:    []concourse.ObjectRef{{Site: "site-a", Device: "server01", Interface: "eth1"}},
+			wantErr: true,
+		},
+		{
+			name:    "activeIpAddress",
+			refs:    []concourse.ObjectRef{{Site: "site-a", Device: "server01", Interface: "eth0", Address: "10.0.0.6/24"}},
+			wantErr: true,
+		},
+		{
+			name:    "interfaceOfActiveDevice",
+			refs:    []concourse.ObjectRef{{Site: "site-a", Device: "server02", Interface: "eth0"}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := planObjectDeletes(test.refs, current, "decommission-approved")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error: %v, got: %v", test.wantErr, err)
+			}
+			if !test.wantErr && !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateObjectRefs(t *testing.T) {
+	tests := []struct {
+		name    string
+		refs    []concourse.ObjectRef
+		wantErr bool
+	}{
+		{"device", []concourse.ObjectRef{{Site: "site-a", Device: "server01"}}, false},
+		{"ipAddress", []concourse.ObjectRef{{Site: "site-a", Device: "server01", Interface: "eth0", Address: "10.0.0.5/24"}}, false},
+		{"missingSite", []concourse.ObjectRef{{Device: "server01"}}, true},
+		{"ipAddressWithoutInterface", []concourse.ObjectRef{{Site: "site-a", Device: "server01", Address: "10.0.0.5/24"}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateObjectRefs(test.refs)
+			if (err != nil) != test.wantErr {
+				t.Errorf("expected error: %v, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestObjects(t *testing.T) {
+	confirmTag := map[string]any{"id": 3, "url": "/api/extras/tags/3/", "display": "decommission-approved", "name": "decommission-approved", "slug": "decommission-approved"}
+	devices := map[string]map[string]any{"server-1": testDevice(1, "server-1", map[string]any{}), "server-2": testDevice(2, "server-2", map[string]any{})}
+	devices["server-2"]["status"] = map[string]any{"value": "offline", "label": "Offline"}
+	devices["server-2"]["tags"] = []any{confirmTag}
+	interfaces := map[string][]any{"1": {testInterface(10, "eth0", "2025-01-01T00:00:00Z")}, "2": {testInterface(11, "eth0", "2025-01-01T00:00:00Z")}}
+	interfaces["2"][0].(map[string]any)["tags"] = []any{confirmTag}
+
+	var (
+		requests []string
+		created  map[string]any
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := func(results []any) {
+			_ = json.NewEncoder(w).Encode(map[string]any{"count": len(results), "results": results})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/dcim/sites/":
+			list([]any{map[string]any{"id": 1, "url": "/api/dcim/sites/1/", "display": "site-a", "name": "site-a", "slug": "site-a"}})
+		case "GET /api/dcim/devices/":
+			list([]any{devices[r.URL.Query().Get("name")]})
+		case "GET /api/dcim/interfaces/":
+			list(interfaces[r.URL.Query().Get("device_id")])
+		case "GET /api/ipam/ip-addresses/":
+			list([]any{})
+		case "POST /api/dcim/interfaces/":
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(testInterface(12, "eth1", "2025-02-01T10:00:00Z"))
+		case "DELETE /api/dcim/interfaces/11/", "DELETE /api/dcim/devices/2/":
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	spec := concourse.ObjectSpec{
+		Create: []concourse.StateDevice{{Site: "site-a", Name: "server-1", Interfaces: []concourse.StateInterface{{Name: "eth0"}, {Name: "eth1", Type: "1000base-t"}}}},
+		Delete: []concourse.ObjectRef{{Site: "site-a", Device: "server-2"}},
+	}
+	input := concourse.Input{Source: concourse.Source{Url: server.URL}, Params: concourse.Params{Objects: &concourse.Objects{Spec: &spec, MaxDeletes: 2, ConfirmTag: "decommission-approved"}}}
+	plan, err := Objects(input, context.Background())
+	if err != nil {
+		t.Fatalf("Objects() error: '%v'", err)
+	}
+
+	expectedRequests := []string{"POST /api/dcim/interfaces/", "DELETE /api/dcim/interfaces/11/", "DELETE /api/dcim/devices/2/"}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("expected requests %v, got %v", expectedRequests, requests)
+	}
+	if !reflect.DeepEqual(created, map[string]any{"name": "eth1", "type": "1000base-t", "device": 1.0}) {
+		t.Errorf("expected interface eth1 created on device 1, got %v", created)
+	}
+	if len(plan) != 3 {
+		t.Errorf("expected the executed changes in the plan, got %v", plan)
+	}
+}
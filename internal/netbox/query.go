@@ -18,7 +18,6 @@ var (
 	netboxFilter    filter.NetboxObject
 	lastUpdatedTime *time.Time
 	referenceTime   time.Time
-	output          []concourse.Version
 	err             error
 )
 
@@ -35,11 +34,19 @@ func Query(input concourse.Input, ctx context.Context) ([]concourse.Version, err
 		return nil, fmt.Errorf("error during device query: %w", err)
 	}
 
-	output, err = fetchDetailsFromDeviceList(input, deviceList, ctx)
+	if netboxFilter.Claimed != nil {
+		lock, err := validateLock(input.Source.Lock)
+		if err != nil {
+			return nil, fmt.Errorf("filter.claimed: %w", err)
+		}
+		deviceList = filterClaimed(deviceList, lock, *netboxFilter.Claimed)
+	}
+
+	versions, err := fetchDetailsFromDeviceList(input, deviceList, ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error during device details query: %w", err)
 	}
-	return output, nil
+	return versions, nil
 }
 
 func createDeviceQuery(client *netbox.APIClient, netboxFilter filter.NetboxObject, ctx context.Context) netbox.ApiDcimDevicesListRequest {
@@ -135,8 +142,9 @@ func runPagedInterfaceQuery(client *netbox.APIClient, netboxFilter filter.Netbox
 func fetchDetailsFromDeviceList(input concourse.Input, deviceList []netbox.DeviceWithConfigContext, ctx context.Context) ([]concourse.Version, error) {
 	var (
 		interfaceList []netbox.Interface
+		versions      []concourse.Version
 	)
-	output = make([]concourse.Version, 0, len(deviceList))
+	output := make([]concourse.Version, 0, len(deviceList))
 
 	for _, d := range deviceList {
 		name := ""
@@ -149,16 +157,17 @@ func fetchDetailsFromDeviceList(input concourse.Input, deviceList []netbox.Devic
 				return nil, fmt.Errorf("error during server interface query: %w", err)
 			}
 
-			output, err = populateInterfaceDetails(name, input, d, interfaceList)
+			versions, err = populateInterfaceDetails(name, input, d, interfaceList)
 			if err != nil {
 				return nil, fmt.Errorf("error during server interface details query: %w", err)
 			}
 		} else {
-			output, err = populateDeviceDetails(name, input, d)
+			versions, err = populateDeviceDetails(name, input, d)
 			if err != nil {
 				return nil, fmt.Errorf("error during device details query: %w", err)
 			}
 		}
+		output = append(output, versions...)
 	}
 	// Sort the output by LastUpdated in ascending order
 	slices.SortStableFunc(output, func(a, b concourse.Version) int {
@@ -168,11 +177,13 @@ func fetchDetailsFromDeviceList(input concourse.Input, deviceList []netbox.Devic
 }
 
 func populateInterfaceDetails(name string, input concourse.Input, device netbox.DeviceWithConfigContext, interfaceList []netbox.Interface) ([]concourse.Version, error) {
+	versions := make([]concourse.Version, 0, len(interfaceList))
 	for _, iface := range interfaceList {
 		lastUpdatedTime, referenceTime, err = getTimestamps(device, input)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing netbox timestamps because of: %w", err)
 		}
+		lastUpdatedTime = interfaceLastUpdated(lastUpdatedTime, iface)
 
 		if lastUpdatedTime.UTC().After(referenceTime) {
 			configContext := ""
@@ -195,7 +206,7 @@ func populateInterfaceDetails(name string, input concourse.Input, device netbox.
 				interfaceDisplayUrl = *iface.DisplayUrl
 			}
 
-			output = append(output, concourse.Version{
+			versions = append(versions, concourse.Version{
 				Id:                  fmt.Sprintf("%d", iface.Id),
 				LastUpdated:         lastUpdatedTime.Format(time.RFC3339),
 				ObjectType:          "interfaces",
@@ -212,10 +223,21 @@ func populateInterfaceDetails(name string, input concourse.Input, device netbox.
 			})
 		}
 	}
-	return output, nil
+	return versions, nil
+}
+
+// interfaceLastUpdated returns the later timestamp of the device and the interface, so the interface version changes with
+// both, and a put or a conflict check can compare it with the last_updated of either object
+func interfaceLastUpdated(deviceLastUpdated *time.Time, iface netbox.Interface) *time.Time {
+	interfaceLastUpdated := iface.LastUpdated.Get()
+	if interfaceLastUpdated != nil && (deviceLastUpdated == nil || interfaceLastUpdated.After(*deviceLastUpdated)) {
+		return interfaceLastUpdated
+	}
+	return deviceLastUpdated
 }
 
 func populateDeviceDetails(name string, input concourse.Input, device netbox.DeviceWithConfigContext) ([]concourse.Version, error) {
+	versions := make([]concourse.Version, 0, 1)
 	lastUpdatedTime, referenceTime, err = getTimestamps(device, input)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing netbox timestamps because of: %w", err)
@@ -237,7 +259,7 @@ func populateDeviceDetails(name string, input concourse.Input, device netbox.Dev
 			displayUrl = *device.DisplayUrl
 		}
 
-		output = append(output, concourse.Version{
+		versions = append(versions, concourse.Version{
 			Id:               fmt.Sprintf("%d", device.Id),
 			LastUpdated:      lastUpdatedTime.Format(time.RFC3339),
 			ObjectType:       "devices",
@@ -248,7 +270,7 @@ func populateDeviceDetails(name string, input concourse.Input, device netbox.Dev
 			ConfigContext:    configContext,
 		})
 	}
-	return output, nil
+	return versions, nil
 }
 
 func serverInterfaceOptionIsSet(device netbox.DeviceWithConfigContext, netboxFilter filter.NetboxObject) bool {
@@ -0,0 +1,159 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+const (
+	defaultScriptTimeout time.Duration = 10 * time.Minute
+	scriptPollInterval   time.Duration = 5 * time.Second
+)
+
+var (
+	finishedJobStatus = []string{"completed", "errored", "failed"}
+)
+
+type ScriptResult struct {
+	JobId  int32  `json:"job_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Log    any    `json:"log"`
+	Output string `json:"output"`
+}
+
+func RunScript(input concourse.Input, ctx context.Context) (concourse.Version, ScriptResult, error) {
+	version := input.Version
+	params := input.Params.Script
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	timeout, err := scriptTimeout(*params)
+	if err != nil {
+		return version, ScriptResult{}, err
+	}
+
+	scriptId, err := getScriptId(client, *params, ctx)
+	if err != nil {
+		return version, ScriptResult{}, err
+	}
+
+	request := netbox.ScriptInputRequest{Data: params.Data, Commit: params.Commit == nil || *params.Commit}
+	if request.Data == nil {
+		request.Data = map[string]any{}
+	}
+
+	// the typed client does not support running a script, which is a POST to the script itself
+	var response map[string]any
+	plannedRequest := PlannedRequest{Method: http.MethodPost, Path: objectPath("extras/scripts", scriptId), Body: request}
+	err = write(client, input.Params.DryRun, plannedRequest, func() error {
+		response, err = requestPath(client, http.MethodPost, plannedRequest.Path, request, ctx)
+		return err
+	}, ctx)
+	if err != nil || input.Params.DryRun {
+		return version, ScriptResult{}, err
+	}
+
+	jobId, ok := nestedValue(response, "result", "id").(float64)
+	if !ok {
+		return version, ScriptResult{}, fmt.Errorf("script %d did not return a job", scriptId)
+	}
+	version.ScriptJob = fmt.Sprintf("%d", int32(jobId))
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	job, err := waitForJob(client, int32(jobId), waitCtx)
+	if err != nil {
+		return version, ScriptResult{}, err
+	}
+
+	result := scriptResult(job)
+	if result.Status != "completed" {
+		return version, result, fmt.Errorf("script %d job %d %s: %s", scriptId, result.JobId, result.Status, result.Error)
+	}
+	return version, result, nil
+}
+
+func FetchScriptResult(input concourse.Input, ctx context.Context) (ScriptResult, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	jobId, err := strconv.ParseInt(input.Version.ScriptJob, 10, 32)
+	if err != nil {
+		return ScriptResult{}, fmt.Errorf("invalid script job id '%s' found in version: %w", input.Version.ScriptJob, err)
+	}
+
+	job, _, err := client.CoreAPI.CoreJobsRetrieve(ctx, int32(jobId)).Execute()
+	if err != nil {
+		return ScriptResult{}, fmt.Errorf("error during CoreJobsRetrieve query: %w", err)
+	}
+	return scriptResult(*job), nil
+}
+
+func waitForJob(client *netbox.APIClient, jobId int32, ctx context.Context) (netbox.Job, error) {
+	for {
+		job, _, err := client.CoreAPI.CoreJobsRetrieve(ctx, jobId).Execute()
+		if err != nil {
+			return netbox.Job{}, fmt.Errorf("error during CoreJobsRetrieve query: %w", err)
+		}
+		if slices.Contains(finishedJobStatus, string(job.Status.GetValue())) {
+			return *job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return netbox.Job{}, fmt.Errorf("job %d did not finish, last status %s: %w", jobId, job.Status.GetValue(), ctx.Err())
+		case <-time.After(scriptPollInterval):
+		}
+	}
+}
+
+func getScriptId(client *netbox.APIClient, params concourse.Script, ctx context.Context) (int32, error) {
+	if params.Id > 0 {
+		return params.Id, nil
+	}
+	if len(params.Name) == 0 {
+		return 0, fmt.Errorf("one of params.script.id or params.script.name is required")
+	}
+
+	scriptList, _, err := client.ExtrasAPI.ExtrasScriptsList(ctx).Name([]string{params.Name}).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("error during ExtrasScriptsList query: %w", err)
+	}
+	if len(scriptList.Results) != 1 {
+		return 0, fmt.Errorf("expected one script %s, found %d", params.Name, len(scriptList.Results))
+	}
+	return scriptList.Results[0].Id, nil
+}
+
+func scriptResult(job netbox.Job) ScriptResult {
+	result := ScriptResult{
+		JobId:  job.Id,
+		Status: string(job.Status.GetValue()),
+		Error:  job.Error,
+		Log:    nestedValue(job.Data, "log"),
+	}
+	if result.Log == nil {
+		result.Log = []any{}
+	}
+	if output, ok := nestedValue(job.Data, "output").(string); ok {
+		result.Output = output
+	}
+	return result
+}
+
+func scriptTimeout(params concourse.Script) (time.Duration, error) {
+	if len(params.Timeout) == 0 {
+		return defaultScriptTimeout, nil
+	}
+	timeout, err := time.ParseDuration(params.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid params.script.timeout, expected a positive duration: %s", params.Timeout)
+	}
+	return timeout, nil
+}
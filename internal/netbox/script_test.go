@@ -0,0 +1,63 @@
+package netbox
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestScriptResult(t *testing.T) {
+	var (
+		status netbox.BriefJobStatus
+	)
+
+	status.SetValue(netbox.BRIEFJOBSTATUSVALUE_ERRORED)
+	logEntries := []any{map[string]any{"status": "failure", "message": "cable missing on eth0"}}
+
+	tests := []struct {
+		name     string
+		data     any
+		expected ScriptResult
+	}{
+		{"logAndOutput", map[string]any{"log": logEntries, "output": "1 check failed"}, ScriptResult{JobId: 7, Status: "errored", Error: "validation failed", Log: logEntries, Output: "1 check failed"}},
+		{"noData", nil, ScriptResult{JobId: 7, Status: "errored", Error: "validation failed", Log: []any{}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := scriptResult(netbox.Job{Id: 7, Status: status, Error: "validation failed", Data: test.data})
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"default", "", defaultScriptTimeout, false},
+		{"duration", "30s", 30 * time.Second, false},
+		{"negative", "-1m", 0, true},
+		{"invalid", "soon", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := scriptTimeout(concourse.Script{Timeout: test.timeout})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("scriptTimeout() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
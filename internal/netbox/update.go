@@ -0,0 +1,306 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func Update(input concourse.Input, ctx context.Context) (concourse.Version, error) {
+	version := input.Version
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	err := validateCustomFields(client, version.ObjectType, input.Params.CustomFields, ctx)
+	if err != nil {
+		return version, err
+	}
+
+	deviceRequest, deviceChanged, err := createDevicePatch(input.Params, version.ObjectType)
+	if err != nil {
+		return version, err
+	}
+
+	deviceId, err := getDeviceId(version)
+	if err != nil {
+		return version, err
+	}
+
+	if len(input.Params.AddTags) > 0 || len(input.Params.RemoveTags) > 0 {
+		tags, tagsChanged, err := updateTags(client, deviceId, input.Params, ctx)
+		if err != nil {
+			return version, err
+		}
+		if tagsChanged {
+			deviceRequest.Tags = tags
+			deviceChanged = true
+		}
+	}
+
+	if input.Params.LocalContext != nil && !targetsVirtualMachine(*input.Params.LocalContext) {
+		localContextData, localContextChanged, err := updateLocalContext(client, deviceId, *input.Params.LocalContext, ctx)
+		if err != nil {
+			return version, err
+		}
+		if localContextChanged {
+			deviceRequest.AdditionalProperties = map[string]any{"local_context_data": localContextData}
+			deviceChanged = true
+		}
+	}
+
+	if deviceChanged {
+		request := PlannedRequest{Method: http.MethodPatch, Path: objectPath("dcim/devices", deviceId), Body: deviceRequest}
+		err := write(client, input.Params.DryRun, request, func() error {
+			device, _, err := client.DcimAPI.DcimDevicesPartialUpdate(ctx, deviceId).PatchedWritableDeviceWithConfigContextRequest(deviceRequest).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimDevicesPartialUpdate request: %w", err)
+			}
+			version = updatedVersion(version, device.LastUpdated.Get())
+			return nil
+		}, ctx)
+		if err != nil {
+			return version, err
+		}
+	}
+
+	if input.Params.LocalContext != nil && targetsVirtualMachine(*input.Params.LocalContext) {
+		if err := updateVirtualMachineLocalContext(client, *input.Params.LocalContext, input.Params.DryRun, ctx); err != nil {
+			return version, err
+		}
+	}
+
+	interfaceRequest, interfaceChanged, err := createInterfacePatch(input.Params, version.ObjectType)
+	if err != nil {
+		return version, err
+	}
+	if interfaceChanged {
+		interfaceId, err := getObjectId(version)
+		if err != nil {
+			return version, err
+		}
+
+		if input.Params.Interface != nil && input.Params.Interface.MacAddress != nil {
+			macAddressId, err := ensureMacAddress(client, interfaceId, *input.Params.Interface.MacAddress, input.Params.DryRun, ctx)
+			if err != nil {
+				return version, err
+			}
+			interfaceRequest.AdditionalProperties["primary_mac_address"] = macAddressId
+		}
+
+		request := PlannedRequest{Method: http.MethodPatch, Path: objectPath("dcim/interfaces", interfaceId), Body: interfaceRequest}
+		err = write(client, input.Params.DryRun, request, func() error {
+			iface, _, err := client.DcimAPI.DcimInterfacesPartialUpdate(ctx, interfaceId).PatchedWritableInterfaceRequest(interfaceRequest).Execute()
+			if err != nil {
+				return fmt.Errorf("error during DcimInterfacesPartialUpdate request: %w", err)
+			}
+			version = updatedVersion(version, iface.LastUpdated.Get())
+			return nil
+		}, ctx)
+		if err != nil {
+			return version, err
+		}
+	}
+	return version, nil
+}
+
+func createDevicePatch(params concourse.Params, objectType string) (netbox.PatchedWritableDeviceWithConfigContextRequest, bool, error) {
+	var (
+		request netbox.PatchedWritableDeviceWithConfigContextRequest
+		changed bool
+	)
+
+	if len(params.Status) > 0 {
+		status, err := netbox.NewDeviceStatusValueFromValue(params.Status)
+		if err != nil {
+			return request, false, fmt.Errorf("invalid params.status: %w", err)
+		}
+		request.Status = status
+		changed = true
+	}
+	if objectType != "interfaces" && len(params.CustomFields) > 0 {
+		request.CustomFields = params.CustomFields
+		changed = true
+	}
+	return request, changed, nil
+}
+
+func createInterfacePatch(params concourse.Params, objectType string) (netbox.PatchedWritableInterfaceRequest, bool, error) {
+	var (
+		request netbox.PatchedWritableInterfaceRequest
+		changed bool
+	)
+	// related objects are referenced by their NetBox id, which is not supported by the nested request types
+	request.AdditionalProperties = map[string]any{}
+
+	if objectType == "interfaces" && len(params.CustomFields) > 0 {
+		request.CustomFields = params.CustomFields
+		changed = true
+	}
+
+	iface := params.Interface
+	if iface == nil {
+		return request, changed, nil
+	}
+	if objectType != "interfaces" {
+		return request, false, fmt.Errorf("params.interface requires a version of object_type interfaces, got %s", objectType)
+	}
+
+	if iface.Enabled != nil {
+		request.Enabled = iface.Enabled
+		changed = true
+	}
+	if iface.Description != nil {
+		request.Description = iface.Description
+		changed = true
+	}
+	if iface.Mtu != nil {
+		request.Mtu.Set(iface.Mtu)
+		changed = true
+	}
+	if iface.Mode != nil {
+		mode, err := netbox.NewPatchedWritableInterfaceRequestModeFromValue(*iface.Mode)
+		if err != nil {
+			return request, false, fmt.Errorf("invalid params.interface.mode: %w", err)
+		}
+		request.Mode.Set(mode)
+		changed = true
+	}
+	if iface.UntaggedVlan != nil {
+		request.AdditionalProperties["untagged_vlan"] = *iface.UntaggedVlan
+		changed = true
+	}
+	if iface.TaggedVlans != nil {
+		request.TaggedVlans = iface.TaggedVlans
+		changed = true
+	}
+	if iface.MacAddress != nil {
+		changed = true
+	}
+	return request, changed, nil
+}
+
+func ensureMacAddress(client *netbox.APIClient, interfaceId int32, macAddress string, dryRun bool, ctx context.Context) (any, error) {
+	macAddressList, _, err := client.DcimAPI.DcimMacAddressesList(ctx).InterfaceId([]int32{interfaceId}).MacAddress([]string{macAddress}).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error during DcimMacAddressesList query: %w", err)
+	}
+	if len(macAddressList.Results) > 0 {
+		return macAddressList.Results[0].Id, nil
+	}
+
+	var macAddressId any = placeholderId("MAC address " + macAddress)
+	request := netbox.MACAddressRequest{MacAddress: macAddress}
+	request.AssignedObjectType.Set(netbox.PtrString("dcim.interface"))
+	request.AssignedObjectId.Set(netbox.PtrInt64(int64(interfaceId)))
+	err = write(client, dryRun, PlannedRequest{Method: http.MethodPost, Path: listPath("dcim/mac-addresses"), Body: request}, func() error {
+		macAddressObject, _, err := client.DcimAPI.DcimMacAddressesCreate(ctx).MACAddressRequest(request).Execute()
+		if err != nil {
+			return fmt.Errorf("error during DcimMacAddressesCreate request: %w", err)
+		}
+		macAddressId = macAddressObject.Id
+		return nil
+	}, ctx)
+	return macAddressId, err
+}
+
+func updateTags(client *netbox.APIClient, deviceId int32, params concourse.Params, ctx context.Context) ([]netbox.NestedTagRequest, bool, error) {
+	var (
+		addTags []netbox.Tag
+	)
+
+	device, err := retrieveDevice(client, deviceId, ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(params.AddTags) > 0 {
+		tagList, _, err := client.ExtrasAPI.ExtrasTagsList(ctx).Slug(params.AddTags).Limit(int32(len(params.AddTags))).Execute()
+		if err != nil {
+			return nil, false, fmt.Errorf("error during ExtrasTagsList query: %w", err)
+		}
+		addTags = tagList.Results
+		for _, slug := range params.AddTags {
+			if !slices.ContainsFunc(addTags, func(tag netbox.Tag) bool { return tag.Slug == slug }) {
+				return nil, false, fmt.Errorf("tag %s is not defined in NetBox", slug)
+			}
+		}
+	}
+
+	tags, changed := mergeTags(device.Tags, addTags, params.RemoveTags)
+	return tags, changed, nil
+}
+
+func mergeTags(currentTags []netbox.NestedTag, addTags []netbox.Tag, removeTags []string) ([]netbox.NestedTagRequest, bool) {
+	changed := false
+	tags := make([]netbox.NestedTagRequest, 0, len(currentTags)+len(addTags))
+	for _, tag := range currentTags {
+		if slices.Contains(removeTags, tag.Slug) {
+			changed = true
+			continue
+		}
+		tags = append(tags, *netbox.NewNestedTagRequest(tag.Name, tag.Slug))
+	}
+	for _, tag := range addTags {
+		if slices.ContainsFunc(tags, func(existing netbox.NestedTagRequest) bool { return existing.Slug == tag.Slug }) {
+			continue
+		}
+		tags = append(tags, *netbox.NewNestedTagRequest(tag.Name, tag.Slug))
+		changed = true
+	}
+	return tags, changed
+}
+
+func validateCustomFields(client *netbox.APIClient, objectType string, customFields map[string]any, ctx context.Context) error {
+	if len(customFields) == 0 {
+		return nil
+	}
+
+	definedFields := make([]string, 0, 25)
+	limit := int32(25)
+	offset := int32(0)
+	for {
+		pagedQuery := client.ExtrasAPI.ExtrasCustomFieldsList(ctx).ObjectType(contentType(objectType)).Limit(limit).Offset(offset)
+		customFieldList, _, err := pagedQuery.Execute()
+		if err != nil {
+			return fmt.Errorf("error during ExtrasCustomFieldsList query: %w", err)
+		}
+		for _, customField := range customFieldList.Results {
+			definedFields = append(definedFields, customField.Name)
+		}
+		if !customFieldList.Next.IsSet() || customFieldList.Next.Get() == nil || *customFieldList.Next.Get() == "" || len(customFieldList.Results) == 0 {
+			break
+		}
+		offset += limit
+	}
+	return checkCustomFieldNames(customFields, definedFields, contentType(objectType))
+}
+
+func checkCustomFieldNames(customFields map[string]any, definedFields []string, contentType string) error {
+	unknownFields := make([]string, 0)
+	for name := range customFields {
+		if !slices.Contains(definedFields, name) {
+			unknownFields = append(unknownFields, name)
+		}
+	}
+	if len(unknownFields) > 0 {
+		slices.Sort(unknownFields)
+		return fmt.Errorf("custom fields %v are not defined for %s in NetBox", unknownFields, contentType)
+	}
+	return nil
+}
+
+// updatedVersion only advances last_updated, as an interface version carries the later timestamp of the device and the interface
+func updatedVersion(version concourse.Version, lastUpdated *time.Time) concourse.Version {
+	if lastUpdated == nil {
+		return version
+	}
+	current, err := getReferenceTime(version.LastUpdated)
+	if err != nil || lastUpdated.UTC().Truncate(time.Second).After(current) {
+		version.LastUpdated = lastUpdated.UTC().Format(time.RFC3339)
+	}
+	return version
+}
@@ -0,0 +1,294 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestCreateDevicePatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		params         concourse.Params
+		objectType     string
+		expectedStatus string
+		expectChanged  bool
+		wantErr        bool
+	}{
+		{"noParams", concourse.Params{}, "devices", "", false, false},
+		{"validStatus", concourse.Params{Status: "staged"}, "devices", "staged", true, false},
+		{"validStatusOfInterfaceDevice", concourse.Params{Status: "staged"}, "interfaces", "staged", true, false},
+		{"invalidStatus", concourse.Params{Status: "broken"}, "devices", "", false, true},
+		{"deviceCustomFields", concourse.Params{CustomFields: map[string]any{"bios_version": "2.1"}}, "devices", "", true, false},
+		{"interfaceCustomFields", concourse.Params{CustomFields: map[string]any{"bios_version": "2.1"}}, "interfaces", "", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, changed, err := createDevicePatch(test.params, test.objectType)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createDevicePatch() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if changed != test.expectChanged {
+				t.Errorf("expected changed %v, got %v", test.expectChanged, changed)
+			}
+			if len(test.expectedStatus) > 0 && (request.Status == nil || string(*request.Status) != test.expectedStatus) {
+				t.Errorf("expected status '%s', got %v", test.expectedStatus, request.Status)
+			}
+		})
+	}
+}
+
+func TestCreateInterfacePatch(t *testing.T) {
+	enabled := false
+	mtu := int32(9000)
+	validMode := "tagged"
+	invalidMode := "trunk"
+	untaggedVlan := int32(10)
+	macAddress := "00:11:22:33:44:55"
+
+	tests := []struct {
+		name          string
+		params        concourse.Params
+		objectType    string
+		expected      string
+		expectChanged bool
+		wantErr       bool
+	}{
+		{"noParams", concourse.Params{}, "interfaces", `{}`, false, false},
+		{"statusOnly", concourse.Params{Status: "active"}, "interfaces", `{}`, false, false},
+		{"interfaceCustomFields", concourse.Params{CustomFields: map[string]any{"applied_vlan": 100}}, "interfaces", `{"custom_fields":{"applied_vlan":100}}`, true, false},
+		{"deviceCustomFields", concourse.Params{CustomFields: map[string]any{"applied_vlan": 100}}, "devices", `{}`, false, false},
+		{"interfaceAttributes", concourse.Params{Interface: &concourse.Interface{Enabled: &enabled, Mtu: &mtu, Mode: &validMode}}, "interfaces", `{"enabled":false,"mode":"tagged","mtu":9000}`, true, false},
+		{"vlans", concourse.Params{Interface: &concourse.Interface{UntaggedVlan: &untaggedVlan, TaggedVlans: []int32{11, 12}}}, "interfaces", `{"tagged_vlans":[11,12],"untagged_vlan":10}`, true, false},
+		{"macAddressOnly", concourse.Params{Interface: &concourse.Interface{MacAddress: &macAddress}}, "interfaces", `{}`, true, false},
+		{"invalidMode", concourse.Params{Interface: &concourse.Interface{Mode: &invalidMode}}, "interfaces", ``, false, true},
+		{"deviceVersion", concourse.Params{Interface: &concourse.Interface{Enabled: &enabled}}, "devices", ``, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, changed, err := createInterfacePatch(test.params, test.objectType)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createInterfacePatch() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if changed != test.expectChanged {
+				t.Errorf("expected changed %v, got %v", test.expectChanged, changed)
+			}
+			if test.wantErr {
+				return
+			}
+			requestBytes, err := json.Marshal(request)
+			if err != nil {
+				t.Fatalf("failed to encode request: %v", err)
+			}
+			if string(requestBytes) != test.expected {
+				t.Errorf("expected request %s, got %s", test.expected, string(requestBytes))
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	currentTags := []netbox.NestedTag{
+		{Name: "Needs Reimage", Slug: "needs-reimage"},
+		{Name: "Rack A", Slug: "rack-a"},
+	}
+
+	tests := []struct {
+		name          string
+		addTags       []netbox.Tag
+		removeTags    []string
+		expected      []string
+		expectChanged bool
+	}{
+		{"noChange", nil, nil, []string{"needs-reimage", "rack-a"}, false},
+		{"addExisting", []netbox.Tag{{Name: "Rack A", Slug: "rack-a"}}, nil, []string{"needs-reimage", "rack-a"}, false},
+		{"addNew", []netbox.Tag{{Name: "Burn-in Passed", Slug: "burn-in-passed"}}, nil, []string{"needs-reimage", "rack-a", "burn-in-passed"}, true},
+		{"removeExisting", nil, []string{"needs-reimage"}, []string{"rack-a"}, true},
+		{"removeMissing", nil, []string{"burn-in-passed"}, []string{"needs-reimage", "rack-a"}, false},
+		{"removeAll", nil, []string{"needs-reimage", "rack-a"}, []string{}, true},
+		{"addAndRemove", []netbox.Tag{{Name: "Burn-in Passed", Slug: "burn-in-passed"}}, []string{"needs-reimage"}, []string{"rack-a", "burn-in-passed"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags, changed := mergeTags(currentTags, test.addTags, test.removeTags)
+			if changed != test.expectChanged {
+				t.Errorf("expected changed %v, got %v", test.expectChanged, changed)
+			}
+			if tags == nil {
+				t.Fatalf("expected non-nil tag list, so that removing all tags is serialized")
+			}
+			slugs := make([]string, 0, len(tags))
+			for _, tag := range tags {
+				slugs = append(slugs, tag.Slug)
+			}
+			if !reflect.DeepEqual(slugs, test.expected) {
+				t.Errorf("expected tags %v, got %v", test.expected, slugs)
+			}
+		})
+	}
+}
+
+func TestCheckCustomFieldNames(t *testing.T) {
+	definedFields := []string{"firmware_version", "bios_version", "last_deployed_commit"}
+
+	tests := []struct {
+		name         string
+		customFields map[string]any
+		wantErr      bool
+	}{
+		{"definedFields", map[string]any{"firmware_version": "1.2.3", "bios_version": "2.1"}, false},
+		{"unknownField", map[string]any{"firmware_version": "1.2.3", "firmware": "1.2.3"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkCustomFieldNames(test.customFields, definedFields, "dcim.device")
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkCustomFieldNames() error: '%v', error expected: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdatedVersion(t *testing.T) {
+	lastUpdated := time.Date(2025, 7, 1, 8, 30, 0, 0, time.UTC)
+	version := concourse.Version{Id: "123", LastUpdated: "2025-06-23T15:16:56Z", ObjectType: "devices"}
+
+	result := updatedVersion(version, &lastUpdated)
+	if result.LastUpdated != "2025-07-01T08:30:00Z" {
+		t.Errorf("expected last_updated '2025-07-01T08:30:00Z', got '%s'", result.LastUpdated)
+	}
+	if result.Id != version.Id {
+		t.Errorf("expected id '%s', got '%s'", version.Id, result.Id)
+	}
+
+	result = updatedVersion(version, nil)
+	if result.LastUpdated != version.LastUpdated {
+		t.Errorf("expected unchanged last_updated '%s', got '%s'", version.LastUpdated, result.LastUpdated)
+	}
+
+	// the interface version already carries the later timestamp of its device
+	earlier := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	result = updatedVersion(version, &earlier)
+	if result.LastUpdated != version.LastUpdated {
+		t.Errorf("expected unchanged last_updated '%s' for an earlier timestamp, got '%s'", version.LastUpdated, result.LastUpdated)
+	}
+}
+
+func TestValidateCustomFieldsPaged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/extras/custom-fields/" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		results := []any{}
+		for i := offset; i < min(offset+limit, 30); i++ {
+			results = append(results, map[string]any{"id": i + 1, "url": fmt.Sprintf("/api/extras/custom-fields/%d/", i+1), "display": fmt.Sprintf("field_%d", i),
+				"object_types": []string{"dcim.device"}, "type": map[string]any{"value": "text", "label": "Text"}, "data_type": "string", "name": fmt.Sprintf("field_%d", i)})
+		}
+		var next any
+		if offset+limit < 30 {
+			next = fmt.Sprintf("%s?limit=%d&offset=%d", r.URL.Path, limit, offset+limit)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"count": 30, "next": next, "results": results})
+	}))
+	defer server.Close()
+
+	client := netbox.NewAPIClientFor(server.URL, "")
+	if err := validateCustomFields(client, "devices", map[string]any{"field_0": "a", "field_29": "b"}, context.Background()); err != nil {
+		t.Errorf("validateCustomFields() error for fields on the second page: '%v'", err)
+	}
+	if err := validateCustomFields(client, "devices", map[string]any{"field_30": "c"}, context.Background()); err == nil {
+		t.Error("expected error for undefined custom field")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	deviceVersion := concourse.Version{Id: "1", LastUpdated: "2025-01-01T00:00:00Z", ObjectType: "devices"}
+	interfaceVersion := concourse.Version{Id: "10", LastUpdated: "2025-01-01T00:00:00Z", ObjectType: "interfaces", DeviceId: "1"}
+	description := "uplink"
+	mtu := int32(9000)
+	untaggedVlan := int32(100)
+
+	tests := []struct {
+		name            string
+		version         concourse.Version
+		params          concourse.Params
+		devicePatch     map[string]any
+		interfacePatch  map[string]any
+		expectedUpdated string
+	}{
+		{"deviceStatusAndCustomFields", deviceVersion, concourse.Params{Status: "offline", CustomFields: map[string]any{"owner": "team-a"}},
+			map[string]any{"status": "offline", "custom_fields": map[string]any{"owner": "team-a"}}, nil, "2025-02-01T10:00:00Z"},
+		{"deviceLocalContext", deviceVersion, concourse.Params{LocalContext: &concourse.LocalContext{Mode: "merge", Data: map[string]any{"rack": 12}}},
+			map[string]any{"local_context_data": map[string]any{"owner": "team-a", "rack": 12.0}}, nil, "2025-02-01T10:00:00Z"},
+		{"interfaceAttributes", interfaceVersion, concourse.Params{Interface: &concourse.Interface{Description: &description, Mtu: &mtu, UntaggedVlan: &untaggedVlan}},
+			nil, map[string]any{"description": "uplink", "mtu": 9000.0, "untagged_vlan": 100.0}, "2025-02-01T11:00:00Z"},
+		{"interfaceVersionDeviceStatus", interfaceVersion, concourse.Params{Status: "offline", CustomFields: map[string]any{"owner": "team-a"}},
+			map[string]any{"status": "offline"}, map[string]any{"custom_fields": map[string]any{"owner": "team-a"}}, "2025-02-01T11:00:00Z"},
+		{"dryRun", deviceVersion, concourse.Params{Status: "offline", DryRun: true}, nil, nil, "2025-01-01T00:00:00Z"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var devicePatch, interfacePatch map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				device := testDevice(1, "server-1", map[string]any{"owner": "team-b"})
+				device["local_context_data"] = map[string]any{"owner": "team-a"}
+				w.Header().Set("Content-Type", "application/json")
+				switch r.Method + " " + r.URL.Path {
+				case "GET /api/extras/custom-fields/":
+					_ = json.NewEncoder(w).Encode(map[string]any{"count": 1, "results": []any{map[string]any{"id": 1, "url": "/api/extras/custom-fields/1/", "display": "owner",
+						"object_types": []string{"dcim.device", "dcim.interface"}, "type": map[string]any{"value": "text", "label": "Text"}, "data_type": "string", "name": "owner"}}})
+				case "GET /api/dcim/devices/1/":
+					_ = json.NewEncoder(w).Encode(device)
+				case "PATCH /api/dcim/devices/1/":
+					_ = json.NewDecoder(r.Body).Decode(&devicePatch)
+					device["last_updated"] = "2025-02-01T10:00:00Z"
+					_ = json.NewEncoder(w).Encode(device)
+				case "PATCH /api/dcim/interfaces/10/":
+					_ = json.NewDecoder(r.Body).Decode(&interfacePatch)
+					_ = json.NewEncoder(w).Encode(testInterface(10, "eth0", "2025-02-01T11:00:00Z"))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			plannedRequests = nil
+			version, err := Update(concourse.Input{Source: concourse.Source{Url: server.URL}, Version: test.version, Params: test.params}, context.Background())
+			if err != nil {
+				t.Fatalf("Update() error: '%v'", err)
+			}
+			if !reflect.DeepEqual(devicePatch, test.devicePatch) {
+				t.Errorf("expected device patch %v, got %v", test.devicePatch, devicePatch)
+			}
+			if !reflect.DeepEqual(interfacePatch, test.interfacePatch) {
+				t.Errorf("expected interface patch %v, got %v", test.interfacePatch, interfacePatch)
+			}
+			if version.LastUpdated != test.expectedUpdated {
+				t.Errorf("expected last_updated %s, got %+v", test.expectedUpdated, version)
+			}
+			if test.params.DryRun && (len(plannedRequests) != 1 || plannedRequests[0].Path != "/api/dcim/devices/1/") {
+				t.Errorf("expected the device patch to be planned, got %v", plannedRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/netbox-community/go-netbox/v4"
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+	"github.com/sapcc/concourse-netbox-resource/internal/filter"
+)
+
+const (
+	registrationCreated   string = "created"
+	registrationUpdated   string = "updated"
+	registrationUnchanged string = "unchanged"
+)
+
+var (
+	defaultEventTypes = []string{"object_created", "object_updated", "object_deleted"}
+)
+
+type Registration struct {
+	ObjectType string `json:"object_type"`
+	Name       string `json:"name"`
+	Id         int32  `json:"id,omitempty"`
+	Result     string `json:"result"`
+}
+
+func (registration Registration) String() string {
+	return fmt.Sprintf("%s %s %s", registration.ObjectType, registration.Name, registration.Result)
+}
+
+func RegisterWebhook(input concourse.Input, payloadUrl string, ctx context.Context) ([]Registration, error) {
+	client = netbox.NewAPIClientFor(input.Source.Url, input.Source.Token)
+
+	params := input.Params.RegisterWebhook
+	if params == nil || len(params.Name) == 0 {
+		return nil, fmt.Errorf("params.register_webhook.name is required")
+	}
+	if len(payloadUrl) == 0 {
+		return nil, fmt.Errorf("params.register_webhook requires url or the resource name and webhook_token to build the Concourse webhook URL")
+	}
+	eventTypes := params.EventTypes
+	if len(eventTypes) == 0 {
+		eventTypes = defaultEventTypes
+	}
+
+	webhookFields := map[string]any{
+		"payload_url":       payloadUrl,
+		"http_method":       http.MethodPost,
+		"http_content_type": "application/json",
+		"secret":            params.Secret,
+		"ssl_verification":  true,
+	}
+	webhook, err := registerObject(client, "extras/webhooks", params.Name, webhookFields, input.Params.DryRun, ctx)
+	if err != nil {
+		return nil, err
+	}
+	registrations := []Registration{webhook}
+
+	var webhookId any = webhook.Id
+	if webhook.Id == 0 {
+		webhookId = placeholderId("webhook " + params.Name)
+	}
+	for _, rule := range eventRules(params.Name, input.Source.Filter) {
+		rule.fields["event_types"] = eventTypes
+		rule.fields["enabled"] = true
+		rule.fields["action_type"] = "webhook"
+		rule.fields["action_object_type"] = "extras.webhook"
+		rule.fields["action_object_id"] = webhookId
+
+		registration, err := registerObject(client, "extras/event-rules", rule.name, rule.fields, input.Params.DryRun, ctx)
+		if err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, registration)
+	}
+	return registrations, nil
+}
+
+type eventRule struct {
+	name   string
+	fields map[string]any
+}
+
+// eventRules only express the filters, which conditions can evaluate exactly, the check applies the complete filter
+func eventRules(name string, netboxFilter filter.NetboxObject) []eventRule {
+	deviceConditions := []any{}
+	for _, condition := range []struct {
+		attr   string
+		values any
+		length int
+	}{
+		{"id", netboxFilter.DeviceId, len(netboxFilter.DeviceId)},
+		{"site.slug", netboxFilter.SiteName, len(netboxFilter.SiteName)},
+		{"role.slug", netboxFilter.Role, len(netboxFilter.Role)},
+		{"device_type.slug", netboxFilter.DeviceType, len(netboxFilter.DeviceType)},
+		{"status.value", netboxFilter.DeviceStatus, len(netboxFilter.DeviceStatus)},
+	} {
+		if condition.length > 0 {
+			deviceConditions = append(deviceConditions, map[string]any{"attr": condition.attr, "value": condition.values, "op": "in"})
+		}
+	}
+	rules := []eventRule{{name: name, fields: map[string]any{"object_types": []string{"dcim.device"}, "conditions": conditions(deviceConditions)}}}
+
+	// interface versions are only reported with an interface filter
+	serverInterface := netboxFilter.ServerInterface
+	if reflect.DeepEqual(serverInterface, filter.ServerInterface{}) {
+		return rules
+	}
+	interfaceConditions := []any{}
+	if len(serverInterface.InterfaceId) > 0 {
+		interfaceConditions = append(interfaceConditions, map[string]any{"attr": "id", "value": serverInterface.InterfaceId, "op": "in"})
+	}
+	if len(netboxFilter.DeviceId) > 0 {
+		interfaceConditions = append(interfaceConditions, map[string]any{"attr": "device.id", "value": netboxFilter.DeviceId, "op": "in"})
+	}
+	if serverInterface.Enabled != nil {
+		interfaceConditions = append(interfaceConditions, map[string]any{"attr": "enabled", "value": *serverInterface.Enabled})
+	}
+	if serverInterface.MgmtOnly != nil {
+		interfaceConditions = append(interfaceConditions, map[string]any{"attr": "mgmt_only", "value": *serverInterface.MgmtOnly})
+	}
+	return append(rules, eventRule{name: name + "-interfaces", fields: map[string]any{"object_types": []string{"dcim.interface"}, "conditions": conditions(interfaceConditions)}})
+}
+
+func conditions(conditionList []any) any {
+	if len(conditionList) == 0 {
+		return nil
+	}
+	return map[string]any{"and": conditionList}
+}
+
+// registerObject creates the object of the name or updates its changed fields, so the registration is idempotent
+func registerObject(client *netbox.APIClient, endpoint string, name string, fields map[string]any, dryRun bool, ctx context.Context) (Registration, error) {
+	var (
+		listResult struct {
+			Results []map[string]any `json:"results"`
+		}
+		created map[string]any
+	)
+
+	registration := Registration{ObjectType: endpoint, Name: name}
+	if err := requestResult(client, http.MethodGet, listPath(endpoint)+"?"+url.Values{"name": {name}}.Encode(), nil, &listResult, ctx); err != nil {
+		return registration, err
+	}
+	if len(listResult.Results) > 1 {
+		return registration, fmt.Errorf("%d objects named %s found in %s", len(listResult.Results), name, endpoint)
+	}
+
+	if len(listResult.Results) == 0 {
+		body := maps.Clone(fields)
+		body["name"] = name
+		request := PlannedRequest{Method: http.MethodPost, Path: listPath(endpoint), Body: body}
+		err := write(client, dryRun, request, func() error {
+			var err error
+			created, err = requestPath(client, http.MethodPost, request.Path, body, ctx)
+			return err
+		}, ctx)
+		registration.Id = int32(toFloat(nestedValue(created, "id")))
+		registration.Result = registrationCreated
+		return registration, err
+	}
+
+	current := listResult.Results[0]
+	registration.Id = int32(toFloat(nestedValue(current, "id")))
+	changed := changedFields(fields, current)
+	if len(changed) == 0 {
+		registration.Result = registrationUnchanged
+		return registration, nil
+	}
+	request := PlannedRequest{Method: http.MethodPatch, Path: objectPath(endpoint, registration.Id), Body: changed}
+	err := write(client, dryRun, request, func() error {
+		_, err := requestPath(client, http.MethodPatch, request.Path, changed, ctx)
+		return err
+	}, ctx)
+	registration.Result = registrationUpdated
+	return registration, err
+}
+
+func changedFields(desired map[string]any, current map[string]any) map[string]any {
+	changed := map[string]any{}
+	for _, field := range slices.Sorted(maps.Keys(desired)) {
+		// choice fields are returned with value and label
+		currentValue := current[field]
+		if value := nestedValue(currentValue, "value"); value != nil {
+			currentValue = value
+		}
+		desiredValue := normalizeValue(desired[field])
+		if desiredList, ok := desiredValue.([]any); ok {
+			currentList, _ := currentValue.([]any)
+			if slices.EqualFunc(sortedValues(desiredList), sortedValues(currentList), reflect.DeepEqual) {
+				continue
+			}
+		} else if reflect.DeepEqual(desiredValue, currentValue) {
+			continue
+		}
+		changed[field] = desired[field]
+	}
+	return changed
+}
+
+// the order of object and event types is not significant
+func sortedValues(values []any) []any {
+	return slices.SortedFunc(slices.Values(values), func(a any, b any) int {
+		return strings.Compare(displayValue(a), displayValue(b))
+	})
+}
@@ -0,0 +1,93 @@
+package netbox
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/filter"
+)
+
+func TestEventRules(t *testing.T) {
+	enabled := true
+
+	tests := []struct {
+		name       string
+		filter     filter.NetboxObject
+		expected   []string
+		conditions []any
+	}{
+		{"noFilter", filter.NetboxObject{}, []string{"netbox"}, []any{nil}},
+		{
+			"deviceFilter",
+			filter.NetboxObject{SiteName: []string{"site-a"}, DeviceStatus: []string{"active"}, DeviceName: []string{"server"}},
+			[]string{"netbox"},
+			[]any{map[string]any{"and": []any{
+				map[string]any{"attr": "site.slug", "value": []any{"site-a"}, "op": "in"},
+				map[string]any{"attr": "status.value", "value": []any{"active"}, "op": "in"},
+			}}},
+		},
+		{
+			"interfaceFilter",
+			filter.NetboxObject{DeviceId: []int32{1}, ServerInterface: filter.ServerInterface{Enabled: &enabled}},
+			[]string{"netbox", "netbox-interfaces"},
+			[]any{
+				map[string]any{"and": []any{map[string]any{"attr": "id", "value": []any{float64(1)}, "op": "in"}}},
+				map[string]any{"and": []any{
+					map[string]any{"attr": "device.id", "value": []any{float64(1)}, "op": "in"},
+					map[string]any{"attr": "enabled", "value": true},
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := eventRules("netbox", test.filter)
+			names := []string{}
+			conditions := []any{}
+			for _, rule := range rules {
+				names = append(names, rule.name)
+				conditions = append(conditions, normalizeValue(rule.fields["conditions"]))
+			}
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected event rules %v, got %v", test.expected, names)
+			}
+			if !reflect.DeepEqual(conditions, test.conditions) {
+				t.Errorf("expected conditions %v, got %v", test.conditions, conditions)
+			}
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	current := map[string]any{
+		"payload_url":  "https://concourse.example.local/hook",
+		"http_method":  "POST",
+		"object_types": []any{"dcim.interface", "dcim.device"},
+		"action_type":  map[string]any{"value": "webhook", "label": "Webhook"},
+		"conditions":   nil,
+	}
+
+	tests := []struct {
+		name     string
+		desired  map[string]any
+		expected []string
+	}{
+		{"unchanged", map[string]any{"http_method": "POST", "object_types": []string{"dcim.device", "dcim.interface"}, "action_type": "webhook", "conditions": nil}, []string{}},
+		{"changed", map[string]any{"payload_url": "https://concourse.example.local/other", "object_types": []string{"dcim.device"}}, []string{"object_types", "payload_url"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := []string{}
+			for field := range changedFields(test.desired, current) {
+				result = append(result, field)
+			}
+			slices.Sort(result)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected changed fields %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
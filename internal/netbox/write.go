@@ -0,0 +1,325 @@
+package netbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/netbox-community/go-netbox/v4"
+)
+
+const (
+	// NetBox limits the length of change log messages
+	maxChangelogMessage int = 200
+)
+
+var (
+	plannedRequests  []PlannedRequest
+	changelogMessage string
+)
+
+type PlannedRequest struct {
+	Method           string         `json:"method"`
+	Path             string         `json:"path"`
+	Body             any            `json:"body,omitempty"`
+	Before           map[string]any `json:"before,omitempty"`
+	ChangelogMessage string         `json:"changelog_message,omitempty"`
+}
+
+// changelogTransport adds the change log message to the JSON body of write requests
+type changelogTransport struct {
+	base    http.RoundTripper
+	message string
+}
+
+func SetChangelogMessage(message string) {
+	if runes := []rune(message); len(runes) > maxChangelogMessage {
+		message = string(runes[:maxChangelogMessage])
+	}
+	changelogMessage = message
+}
+
+func PlannedRequests() []PlannedRequest {
+	if plannedRequests == nil {
+		return []PlannedRequest{}
+	}
+	return plannedRequests
+}
+
+func (request PlannedRequest) Diff() string {
+	var (
+		diff strings.Builder
+	)
+
+	fmt.Fprintf(&diff, "%s %s\n", request.Method, request.Path)
+	if request.Method == http.MethodDelete {
+		diff.WriteString("- object\n")
+	}
+
+	// the allocation and bulk endpoints expect a list of objects
+	bodies := []any{normalizeValue(request.Body)}
+	bodyList, isList := bodies[0].([]any)
+	if isList {
+		bodies = bodyList
+	}
+	for _, item := range bodies {
+		body, _ := item.(map[string]any)
+		before, prefix := request.Before, ""
+		// bulk updates are identified by the id of each object
+		if isList && request.Method == http.MethodPatch {
+			id := displayValue(body["id"])
+			body = maps.Clone(body)
+			delete(body, "id")
+			before, _ = request.Before[id].(map[string]any)
+			prefix = id + "."
+		}
+		for _, field := range slices.Sorted(maps.Keys(body)) {
+			switch {
+			case request.Method == http.MethodPost:
+				fmt.Fprintf(&diff, "+ %s: %s\n", field, displayValue(body[field]))
+			case before != nil:
+				fmt.Fprintf(&diff, "~ %s%s: %s -> %s\n", prefix, field, displayValue(before[field]), displayValue(body[field]))
+			default:
+				fmt.Fprintf(&diff, "~ %s%s: %s\n", prefix, field, displayValue(body[field]))
+			}
+		}
+	}
+	return diff.String()
+}
+
+// write executes the request, unless it is only recorded for a dry run
+func write(client *netbox.APIClient, dryRun bool, request PlannedRequest, execute func() error, ctx context.Context) error {
+	if !dryRun {
+		if client == nil || len(changelogMessage) == 0 {
+			return execute()
+		}
+		config := client.GetConfig()
+		httpClient := config.HTTPClient
+		config.HTTPClient = changelogClient(httpClient, changelogMessage)
+		defer func() { config.HTTPClient = httpClient }()
+		return execute()
+	}
+
+	request.ChangelogMessage = changelogMessage
+	if request.Method == http.MethodPatch {
+		before, err := currentValues(client, request, ctx)
+		if err != nil {
+			return err
+		}
+		request.Before = before
+	}
+	plannedRequests = append(plannedRequests, request)
+	return nil
+}
+
+// currentValues returns the current values of the patched fields, keyed by id for bulk updates
+func currentValues(client *netbox.APIClient, request PlannedRequest, ctx context.Context) (map[string]any, error) {
+	var (
+		bulkResult struct {
+			Results []map[string]any `json:"results"`
+		}
+	)
+
+	before := map[string]any{}
+	bodyList, ok := normalizeValue(request.Body).([]any)
+	if !ok {
+		current, err := requestPath(client, http.MethodGet, request.Path, nil, ctx)
+		if err != nil {
+			return nil, err
+		}
+		body, _ := normalizeValue(request.Body).(map[string]any)
+		for field := range body {
+			before[field] = current[field]
+		}
+		return before, nil
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(len(bodyList))}}
+	for _, item := range bodyList {
+		query.Add("id", displayValue(nestedValue(item, "id")))
+	}
+	if err := requestResult(client, http.MethodGet, request.Path+"?"+query.Encode(), nil, &bulkResult, ctx); err != nil {
+		return nil, err
+	}
+	for _, item := range bodyList {
+		body, _ := item.(map[string]any)
+		id := displayValue(body["id"])
+		index := slices.IndexFunc(bulkResult.Results, func(current map[string]any) bool { return displayValue(current["id"]) == id })
+		if index < 0 {
+			continue
+		}
+		fields := map[string]any{}
+		for field := range body {
+			fields[field] = bulkResult.Results[index][field]
+		}
+		before[id] = fields
+	}
+	return before, nil
+}
+
+// requestPath is used for endpoints, which are not covered by the typed client
+func requestPath(client *netbox.APIClient, method string, path string, body any, ctx context.Context) (map[string]any, error) {
+	var (
+		fields map[string]any
+	)
+
+	if err := requestResult(client, method, path, body, &fields, ctx); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// requestResult decodes the response into result, e.g. the list returned by bulk endpoints
+func requestResult(client *netbox.APIClient, method string, path string, body any, result any, ctx context.Context) error {
+	var (
+		bodyReader io.Reader
+	)
+
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request for %s: %w", path, err)
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+	}
+
+	config := client.GetConfig()
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(config.Servers[0].URL, "/")+path, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", path, err)
+	}
+	for name, value := range config.DefaultHeader {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error during %s %s request: %w", method, path, err)
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to close response body of %s: %w", path, err))
+		}
+	}()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		responseBody, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("error during %s %s request: %s %s", method, path, response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func changelogClient(httpClient *http.Client, message string) *http.Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *httpClient
+	wrapped.Transport = changelogTransport{base: base, message: message}
+	return &wrapped
+}
+
+func (transport changelogTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var (
+		body any = map[string]any{}
+	)
+
+	if request.Method == http.MethodGet || request.Method == http.MethodHead {
+		return transport.base.RoundTrip(request)
+	}
+
+	if request.Body != nil && request.Body != http.NoBody {
+		// the transport has to close the request body, also on errors
+		bodyBytes, err := io.ReadAll(request.Body)
+		if closeErr := request.Body.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close request body: %w", closeErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// bodies, which are not JSON, are sent unchanged
+		if err := json.Unmarshal(bodyBytes, &body); err != nil {
+			request = request.Clone(request.Context())
+			request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			return transport.base.RoundTrip(request)
+		}
+	}
+
+	bodyBytes, err := json.Marshal(withChangelogMessage(body, transport.message))
+	if err != nil {
+		return nil, err
+	}
+	request = request.Clone(request.Context())
+	request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	request.ContentLength = int64(len(bodyBytes))
+	request.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(bodyBytes)), nil }
+	request.Header.Set("Content-Type", "application/json")
+	return transport.base.RoundTrip(request)
+}
+
+// bulk requests carry the message in every object, explicit messages are kept
+func withChangelogMessage(body any, message string) any {
+	switch value := body.(type) {
+	case map[string]any:
+		if _, ok := value["changelog_message"]; !ok {
+			value["changelog_message"] = message
+		}
+	case []any:
+		for _, item := range value {
+			withChangelogMessage(item, message)
+		}
+	}
+	return body
+}
+
+func objectPath(endpoint string, id int32) string {
+	return fmt.Sprintf("/api/%s/%d/", endpoint, id)
+}
+
+func listPath(endpoint string) string {
+	return fmt.Sprintf("/api/%s/", endpoint)
+}
+
+// objects created in a dry run have no id yet
+func placeholderId(object string) string {
+	return fmt.Sprintf("<id of %s>", object)
+}
+
+// nested objects are shown by their value or display name
+func displayValue(value any) string {
+	if valueMap, ok := value.(map[string]any); ok {
+		for _, key := range []string{"value", "display"} {
+			if nested, ok := valueMap[key]; ok {
+				value = nested
+				break
+			}
+		}
+	}
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(valueBytes)
+}
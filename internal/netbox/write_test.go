@@ -0,0 +1,137 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/netbox-community/go-netbox/v4"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		dryRun   bool
+		executed bool
+		planned  int
+	}{
+		{"execute", false, true, 0},
+		{"dryRun", true, false, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plannedRequests = nil
+			executed := false
+			request := PlannedRequest{Method: http.MethodPost, Path: listPath("extras/journal-entries"), Body: map[string]any{"comments": "deployed"}}
+			err := write(nil, test.dryRun, request, func() error {
+				executed = true
+				return nil
+			}, context.Background())
+			if err != nil {
+				t.Fatalf("write() error: '%v'", err)
+			}
+			if executed != test.executed {
+				t.Errorf("expected executed to be %v, got %v", test.executed, executed)
+			}
+			if len(PlannedRequests()) != test.planned {
+				t.Errorf("expected %d planned requests, got %d", test.planned, len(PlannedRequests()))
+			}
+		})
+	}
+}
+
+func TestPlannedRequestDiff(t *testing.T) {
+	status := netbox.PatchedWritableDeviceWithConfigContextRequest{
+		AdditionalProperties: map[string]any{"status": "planned"},
+	}
+
+	tests := []struct {
+		name     string
+		request  PlannedRequest
+		expected string
+	}{
+		{
+			"patchWithBefore",
+			PlannedRequest{Method: http.MethodPatch, Path: objectPath("dcim/devices", 1), Body: status, Before: map[string]any{"status": map[string]any{"value": "active", "label": "Active"}}},
+			"PATCH /api/dcim/devices/1/\n~ status: \"active\" -> \"planned\"\n",
+		},
+		{
+			"postList",
+			PlannedRequest{Method: http.MethodPost, Path: objectPath("ipam/vlan-groups", 2) + "available-vlans/", Body: []map[string]any{{"name": "tenant-a", "vid": 100}}},
+			"POST /api/ipam/vlan-groups/2/available-vlans/\n+ name: \"tenant-a\"\n+ vid: 100\n",
+		},
+		{
+			"bulkPatch",
+			PlannedRequest{Method: http.MethodPatch, Path: listPath("dcim/devices"), Body: []map[string]any{{"id": 1, "serial": "ABC"}, {"id": 2, "serial": "DEF"}}, Before: map[string]any{"1": map[string]any{"serial": ""}}},
+			"PATCH /api/dcim/devices/\n~ 1.serial: \"\" -> \"ABC\"\n~ 2.serial: \"DEF\"\n",
+		},
+		{
+			"delete",
+			PlannedRequest{Method: http.MethodDelete, Path: objectPath("dcim/interfaces", 3)},
+			"DELETE /api/dcim/interfaces/3/\n- object\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.request.Diff()
+			if result != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestChangelogTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		expected any
+	}{
+		{"patch", http.MethodPatch, `{"status":"active"}`, map[string]any{"status": "active", "changelog_message": "deploy #42"}},
+		{"explicitMessage", http.MethodPost, `{"changelog_message":"manual"}`, map[string]any{"changelog_message": "manual"}},
+		{"bulk", http.MethodPatch, `[{"id":1},{"id":2}]`, []any{map[string]any{"id": float64(1), "changelog_message": "deploy #42"}, map[string]any{"id": float64(2), "changelog_message": "deploy #42"}}},
+		{"delete", http.MethodDelete, "", map[string]any{"changelog_message": "deploy #42"}},
+		{"get", http.MethodGet, "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				bodyBytes, _ := io.ReadAll(r.Body)
+				if len(bodyBytes) > 0 {
+					_ = json.Unmarshal(bodyBytes, &received)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			var body io.Reader
+			if len(test.body) > 0 {
+				body = strings.NewReader(test.body)
+			}
+			request, err := http.NewRequest(test.method, server.URL, body)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			response, err := changelogClient(nil, "deploy #42").Do(request)
+			if err != nil {
+				t.Fatalf("request error: '%v'", err)
+			}
+			if err := response.Body.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(received, test.expected) {
+				t.Errorf("expected body %v, got %v", test.expected, received)
+			}
+		})
+	}
+}
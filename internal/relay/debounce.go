@@ -0,0 +1,82 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Debouncer coalesces the matches of a rule within the delay into a single call of its webhook
+type Debouncer struct {
+	delay   time.Duration
+	call    func(rule Rule)
+	mutex   sync.Mutex
+	pending map[string]*time.Timer
+	rules   map[string]Rule
+}
+
+func NewDebouncer(delay time.Duration, call func(rule Rule)) *Debouncer {
+	return &Debouncer{delay: delay, call: call, pending: map[string]*time.Timer{}, rules: map[string]Rule{}}
+}
+
+func (debouncer *Debouncer) Trigger(rule Rule) {
+	debouncer.mutex.Lock()
+	defer debouncer.mutex.Unlock()
+
+	if _, ok := debouncer.pending[rule.Name]; ok {
+		return
+	}
+	debouncer.rules[rule.Name] = rule
+	debouncer.pending[rule.Name] = time.AfterFunc(debouncer.delay, func() {
+		debouncer.mutex.Lock()
+		delete(debouncer.pending, rule.Name)
+		debouncer.mutex.Unlock()
+		debouncer.call(rule)
+	})
+}
+
+// Flush calls the webhooks of all pending rules immediately, e.g. on shutdown
+func (debouncer *Debouncer) Flush() {
+	debouncer.mutex.Lock()
+	flushed := []Rule{}
+	for name, timer := range debouncer.pending {
+		if timer.Stop() {
+			flushed = append(flushed, debouncer.rules[name])
+		}
+		delete(debouncer.pending, name)
+	}
+	debouncer.mutex.Unlock()
+
+	for _, rule := range flushed {
+		debouncer.call(rule)
+	}
+}
+
+// CallWebhook triggers the check of the Concourse resource, errors are only logged, as the check interval still applies
+func CallWebhook(client *http.Client, rule Rule, ctx context.Context) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.WebhookUrl, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to create webhook request of rule %s: %w", rule.Name, err))
+		return
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("error during webhook request of rule %s: %w", rule.Name, err))
+		return
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to close webhook response of rule %s: %w", rule.Name, err))
+		}
+	}()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		responseBody, _ := io.ReadAll(response.Body)
+		fmt.Fprintf(os.Stderr, "webhook request of rule %s failed: %s %s\n", rule.Name, response.Status, responseBody)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "triggered check of rule %s\n", rule.Name)
+}
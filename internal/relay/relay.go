@@ -0,0 +1,192 @@
+package relay
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/filter"
+)
+
+const (
+	signatureHeader string = "X-Hook-Signature"
+	// NetBox payloads of single objects are small, larger bodies are rejected
+	maxPayloadSize int64 = 1 << 20
+)
+
+type Config struct {
+	Listen   string `json:"listen,omitempty"`
+	Secret   string `json:"secret"`
+	Debounce string `json:"debounce,omitempty"`
+	Rules    []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Name       string              `json:"name"`
+	Filter     filter.NetboxObject `json:"filter"`
+	WebhookUrl string              `json:"webhook_url"`
+}
+
+type Payload struct {
+	Event     string         `json:"event"`
+	Timestamp string         `json:"timestamp"`
+	Model     string         `json:"model"`
+	Username  string         `json:"username"`
+	RequestId string         `json:"request_id"`
+	Data      map[string]any `json:"data"`
+}
+
+type Trigger interface {
+	Trigger(rule Rule)
+}
+
+func NewHandler(config Config, trigger Trigger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		var (
+			payload Payload
+		)
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !VerifySignature(body, r.Header.Get(signatureHeader), config.Secret) {
+			fmt.Fprintf(os.Stderr, "rejected webhook from %s: invalid %s\n", r.RemoteAddr, signatureHeader)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		matched := []string{}
+		for _, rule := range config.Rules {
+			if Match(rule.Filter, payload) {
+				matched = append(matched, rule.Name)
+				trigger.Trigger(rule)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s %s %v by %s matched %d rules %v\n", payload.Event, payload.Model, payload.Data["id"], payload.Username, len(matched), matched)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return mux
+}
+
+// NetBox signs the body with HMAC-SHA512 of the webhook secret
+func VerifySignature(body []byte, signature string, secret string) bool {
+	if len(signature) == 0 || len(secret) == 0 {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Match evaluates the filter like the check query, filters, which can not be evaluated on the payload, are assumed to match
+func Match(netboxFilter filter.NetboxObject, payload Payload) bool {
+	switch payload.Model {
+	case "device":
+		return matchDevice(netboxFilter, payload.Data)
+	case "interface":
+		// interface versions are only reported with an interface filter
+		if isEmptyInterfaceFilter(netboxFilter.ServerInterface) {
+			return false
+		}
+		// the interface payload only contains the id and name of the device
+		device, _ := payload.Data["device"].(map[string]any)
+		return matchIds(netboxFilter.DeviceId, device["id"]) &&
+			matchContains(netboxFilter.DeviceName, device["name"]) &&
+			matchInterface(netboxFilter.ServerInterface, payload.Data)
+	default:
+		return false
+	}
+}
+
+func matchDevice(netboxFilter filter.NetboxObject, data map[string]any) bool {
+	return matchIds(netboxFilter.DeviceId, data["id"]) &&
+		matchContains(netboxFilter.DeviceName, data["name"]) &&
+		matchValues(netboxFilter.SiteName, nested(data, "site", "slug")) &&
+		matchValues(netboxFilter.Role, nested(data, "role", "slug")) &&
+		matchValues(netboxFilter.DeviceType, nested(data, "device_type", "slug")) &&
+		matchValues(netboxFilter.DeviceStatus, nested(data, "status", "value")) &&
+		matchTags(netboxFilter.Tag, data["tags"])
+}
+
+func matchInterface(serverInterface filter.ServerInterface, data map[string]any) bool {
+	cabled := data["cable"] != nil
+	endpoints, _ := data["connected_endpoints"].([]any)
+	return matchIds(serverInterface.InterfaceId, data["id"]) &&
+		matchContains(serverInterface.InterfaceName, data["name"]) &&
+		matchContains(serverInterface.Type, nested(data, "type", "value")) &&
+		matchBool(serverInterface.Enabled, data["enabled"]) &&
+		matchBool(serverInterface.MgmtOnly, data["mgmt_only"]) &&
+		matchBool(serverInterface.Cabled, cabled) &&
+		matchBool(serverInterface.Connected, len(endpoints) > 0)
+}
+
+func isEmptyInterfaceFilter(serverInterface filter.ServerInterface) bool {
+	return len(serverInterface.InterfaceId) == 0 && len(serverInterface.InterfaceName) == 0 && len(serverInterface.Type) == 0 &&
+		serverInterface.Enabled == nil && serverInterface.MgmtOnly == nil && serverInterface.Connected == nil && serverInterface.Cabled == nil
+}
+
+func matchIds(ids []int32, value any) bool {
+	id, _ := value.(float64)
+	return len(ids) == 0 || slices.Contains(ids, int32(id))
+}
+
+func matchValues(values []string, value any) bool {
+	text, _ := value.(string)
+	return len(values) == 0 || slices.Contains(values, text)
+}
+
+// names are filtered case-insensitive contains like the name__ic query
+func matchContains(values []string, value any) bool {
+	text, _ := value.(string)
+	return len(values) == 0 || slices.ContainsFunc(values, func(filterValue string) bool {
+		return strings.Contains(strings.ToLower(text), strings.ToLower(filterValue))
+	})
+}
+
+func matchBool(filterValue *bool, value any) bool {
+	boolValue, _ := value.(bool)
+	return filterValue == nil || *filterValue == boolValue
+}
+
+func matchTags(tags []string, value any) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	objectTags, _ := value.([]any)
+	return slices.ContainsFunc(objectTags, func(tag any) bool {
+		slug, _ := nested(tag, "slug").(string)
+		return slices.Contains(tags, slug)
+	})
+}
+
+func nested(value any, path ...string) any {
+	for _, key := range path {
+		valueMap, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = valueMap[key]
+	}
+	return value
+}
@@ -0,0 +1,164 @@
+package relay
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/filter"
+)
+
+type recordingTrigger struct {
+	rules []string
+}
+
+func (trigger *recordingTrigger) Trigger(rule Rule) {
+	trigger.rules = append(trigger.rules, rule.Name)
+}
+
+func sign(body string, secret string) string {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"event":"updated"}`)
+
+	tests := []struct {
+		name      string
+		signature string
+		secret    string
+		expected  bool
+	}{
+		{"valid", sign(string(body), "secret"), "secret", true},
+		{"wrongSecret", sign(string(body), "other"), "secret", false},
+		{"missingSignature", "", "secret", false},
+		{"invalidHex", "zz", "secret", false},
+		{"missingSecret", sign(string(body), ""), "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := VerifySignature(body, test.signature, test.secret); result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	enabled := true
+	device := map[string]any{
+		"id":          float64(1),
+		"name":        "Server01",
+		"site":        map[string]any{"slug": "site-a"},
+		"role":        map[string]any{"slug": "server"},
+		"device_type": map[string]any{"slug": "r640"},
+		"status":      map[string]any{"value": "active"},
+		"tags":        []any{map[string]any{"slug": "managed"}},
+	}
+	iface := map[string]any{
+		"id":      float64(10),
+		"name":    "eth0",
+		"device":  map[string]any{"id": float64(1), "name": "server01"},
+		"type":    map[string]any{"value": "1000base-t"},
+		"enabled": true,
+		"cable":   nil,
+	}
+
+	tests := []struct {
+		name     string
+		filter   filter.NetboxObject
+		payload  Payload
+		expected bool
+	}{
+		{"deviceWithoutFilter", filter.NetboxObject{}, Payload{Model: "device", Data: device}, true},
+		{"deviceMatch", filter.NetboxObject{SiteName: []string{"site-a"}, DeviceName: []string{"server"}, DeviceStatus: []string{"active"}, Tag: []string{"managed", "other"}}, Payload{Model: "device", Data: device}, true},
+		{"deviceOtherSite", filter.NetboxObject{SiteName: []string{"site-b"}}, Payload{Model: "device", Data: device}, false},
+		{"deviceOtherTag", filter.NetboxObject{Tag: []string{"other"}}, Payload{Model: "device", Data: device}, false},
+		{"interfaceWithoutFilter", filter.NetboxObject{}, Payload{Model: "interface", Data: iface}, false},
+		{"interfaceMatch", filter.NetboxObject{DeviceId: []int32{1}, SiteName: []string{"site-b"}, ServerInterface: filter.ServerInterface{Enabled: &enabled, Type: []string{"base-t"}}}, Payload{Model: "interface", Data: iface}, true},
+		{"interfaceCabled", filter.NetboxObject{ServerInterface: filter.ServerInterface{Cabled: &enabled}}, Payload{Model: "interface", Data: iface}, false},
+		{"otherModel", filter.NetboxObject{}, Payload{Model: "site", Data: map[string]any{}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := Match(test.filter, test.payload); result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	config := Config{
+		Secret: "secret",
+		Rules: []Rule{
+			{Name: "site-a", Filter: filter.NetboxObject{SiteName: []string{"site-a"}}},
+			{Name: "site-b", Filter: filter.NetboxObject{SiteName: []string{"site-b"}}},
+		},
+	}
+	body := `{"event":"updated","model":"device","data":{"id":1,"site":{"slug":"site-a"}}}`
+
+	tests := []struct {
+		name      string
+		signature string
+		expected  int
+		triggered []string
+	}{
+		{"valid", sign(body, "secret"), http.StatusAccepted, []string{"site-a"}},
+		{"invalidSignature", sign(body, "other"), http.StatusUnauthorized, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trigger := &recordingTrigger{}
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			request.Header.Set(signatureHeader, test.signature)
+			recorder := httptest.NewRecorder()
+
+			NewHandler(config, trigger).ServeHTTP(recorder, request)
+			if recorder.Code != test.expected {
+				t.Errorf("expected status %d, got %d", test.expected, recorder.Code)
+			}
+			if strings.Join(trigger.rules, ",") != strings.Join(test.triggered, ",") {
+				t.Errorf("expected triggered rules %v, got %v", test.triggered, trigger.rules)
+			}
+		})
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		calls []string
+	)
+
+	debouncer := NewDebouncer(50*time.Millisecond, func(rule Rule) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls = append(calls, rule.Name)
+	})
+	for range 3 {
+		debouncer.Trigger(Rule{Name: "site-a"})
+	}
+	debouncer.Trigger(Rule{Name: "site-b"})
+	time.Sleep(150 * time.Millisecond)
+
+	debouncer.Trigger(Rule{Name: "site-a"})
+	debouncer.Flush()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(calls) != 3 {
+		t.Errorf("expected 3 coalesced calls, got %v", calls)
+	}
+}
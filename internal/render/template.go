@@ -0,0 +1,55 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+var (
+	funcMap = template.FuncMap{
+		"toJson": func(value any) (string, error) {
+			valueBytes, err := json.Marshal(value)
+			return string(valueBytes), err
+		},
+		"toPrettyJson": func(value any) (string, error) {
+			valueBytes, err := json.MarshalIndent(value, "", "  ")
+			return string(valueBytes), err
+		},
+	}
+)
+
+func Template(templatePath string, data any, writer io.Writer) error {
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read template file %s: %w", templatePath, err)
+	}
+
+	if err := execute(filepath.Base(templatePath), string(content), data, writer); err != nil {
+		return fmt.Errorf("failed to render template file %s: %w", templatePath, err)
+	}
+	return nil
+}
+
+func String(name string, text string, data any) (string, error) {
+	var (
+		result bytes.Buffer
+	)
+
+	if err := execute(name, text, data, &result); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return result.String(), nil
+}
+
+func execute(name string, text string, data any, writer io.Writer) error {
+	tmpl, err := template.New(name).Funcs(funcMap).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl.Execute(writer, data)
+}
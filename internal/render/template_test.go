@@ -0,0 +1,81 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	data := map[string]any{
+		"device": map[string]any{
+			"name": "server01",
+		},
+		"interfaces": []any{
+			map[string]any{"name": "eth0"},
+			map[string]any{"name": "eth1"},
+		},
+		"config_context": map[string]any{
+			"environment": "production",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{"deviceName", "host {{ .device.name }}", "host server01", false},
+		{"interfaceRange", "{{ range .interfaces }}{{ .name }};{{ end }}", "eth0;eth1;", false},
+		{"toJson", "{{ toJson .config_context }}", `{"environment":"production"}`, false},
+		{"missingKey", "{{ .device.serial }}", "", true},
+		{"invalidSyntax", "{{ .device.name ", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			templatePath := filepath.Join(t.TempDir(), "host.cfg.tmpl")
+			if err := os.WriteFile(templatePath, []byte(test.template), 0644); err != nil {
+				t.Fatalf("failed to create template file: %v", err)
+			}
+
+			var result bytes.Buffer
+			err := Template(templatePath, data, &result)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Template() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if !test.wantErr && result.String() != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result.String())
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	data := map[string]string{"BUILD_NAME": "42"}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+		wantErr  bool
+	}{
+		{"plainText", "deployed", "deployed", false},
+		{"variable", "build #{{ .BUILD_NAME }}", "build #42", false},
+		{"missingVariable", "{{ .BUILD_JOB_NAME }}", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := String(test.name, test.text, data)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("String() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if result != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+type Config struct {
+	Source    concourse.Source `json:"source"`
+	Interval  string           `json:"interval,omitempty"`
+	StateFile string           `json:"state_file"`
+	Command   []string         `json:"command,omitempty"`
+	Once      bool             `json:"once,omitempty"`
+}
+
+type QueryFunc func(input concourse.Input, ctx context.Context) ([]concourse.Version, error)
+
+// State contains the last handled version and the keys of all handled versions with its timestamp, as interface versions
+// share the timestamp of their device
+type State struct {
+	Version concourse.Version `json:"version"`
+	Seen    []string          `json:"seen,omitempty"`
+}
+
+// ReadState returns the last seen state, an empty state is returned before the first run
+func ReadState(path string) (State, error) {
+	var (
+		state State
+	)
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("failed to read state file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return State{}, fmt.Errorf("failed to decode state file %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// WriteState replaces the state file atomically, so an interrupted write does not lose the last seen version
+func WriteState(path string, state State) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer func() {
+		// the temporary file is already renamed after a successful write
+		if err := os.Remove(file.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to remove temporary state file: %w", err))
+		}
+	}()
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		if closeErr := file.Close(); closeErr != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to close temporary state file: %w", closeErr))
+		}
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Poll queries the versions newer than the state and handles them in order, the state is advanced after each handled version
+func Poll(config Config, query QueryFunc, stdout io.Writer, ctx context.Context) (int, error) {
+	state, err := ReadState(config.StateFile)
+	if err != nil {
+		return 0, err
+	}
+	stateTime, err := parseTime(state.Version.LastUpdated)
+	if err != nil {
+		return 0, fmt.Errorf("invalid last_updated in state file: %w", err)
+	}
+
+	// the version timestamps have no fractional seconds, so the query starts a second earlier and handled versions are skipped
+	reference := state.Version
+	if !stateTime.IsZero() {
+		reference.LastUpdated = stateTime.Add(-time.Second).Format(time.RFC3339)
+	}
+	versions, err := query(concourse.Input{Source: config.Source, Version: reference}, ctx)
+	if err != nil {
+		return 0, fmt.Errorf("netbox query failed: %w", err)
+	}
+
+	handled := 0
+	for _, version := range versions {
+		versionTime, err := parseTime(version.LastUpdated)
+		if err != nil {
+			return handled, fmt.Errorf("invalid last_updated of version %s %s: %w", version.ObjectType, version.Id, err)
+		}
+		key := versionKey(version)
+		if !stateTime.IsZero() && (versionTime.Before(stateTime) || versionTime.Equal(stateTime) && slices.Contains(state.Seen, key)) {
+			continue
+		}
+
+		if err := handleVersion(version, config.Command, stdout, ctx); err != nil {
+			return handled, fmt.Errorf("failed to handle version %s %s: %w", version.ObjectType, version.Id, err)
+		}
+		handled++
+
+		if !versionTime.Equal(stateTime) {
+			state.Seen = nil
+			stateTime = versionTime
+		}
+		state.Version = version
+		state.Seen = append(state.Seen, key)
+		if err := WriteState(config.StateFile, state); err != nil {
+			return handled, err
+		}
+	}
+	return handled, nil
+}
+
+func versionKey(version concourse.Version) string {
+	return version.ObjectType + "/" + version.Id
+}
+
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleVersion writes the version as JSON line, or passes it to the command on stdin and in environment variables
+func handleVersion(version concourse.Version, command []string, stdout io.Writer, ctx context.Context) error {
+	versionBytes, err := json.Marshal(version)
+	if err != nil {
+		return fmt.Errorf("failed to encode version: %w", err)
+	}
+	if len(command) == 0 {
+		_, err := stdout.Write(append(versionBytes, '\n'))
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(versionBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"NETBOX_ID="+version.Id,
+		"NETBOX_OBJECT_TYPE="+version.ObjectType,
+		"NETBOX_LAST_UPDATED="+version.LastUpdated,
+		"NETBOX_DEVICE_ID="+version.DeviceId,
+		"NETBOX_DEVICE_NAME="+version.DeviceName,
+		"NETBOX_INTERFACE_NAME="+version.InterfaceName,
+	)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command %s failed: %w", command[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/concourse-netbox-resource/internal/concourse"
+)
+
+func TestReadWriteState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := ReadState(stateFile)
+	if err != nil {
+		t.Fatalf("ReadState() of missing file error: %v", err)
+	}
+	if !reflect.DeepEqual(state, State{}) {
+		t.Errorf("expected empty state before the first run, got %+v", state)
+	}
+
+	version := concourse.Version{Id: "123", LastUpdated: "2025-01-02T03:04:05Z", ObjectType: "devices", DeviceName: "server-1"}
+	written := State{Version: version, Seen: []string{"devices/123"}}
+	if err := WriteState(stateFile, written); err != nil {
+		t.Fatalf("WriteState() error: %v", err)
+	}
+	state, err = ReadState(stateFile)
+	if err != nil {
+		t.Fatalf("ReadState() error: %v", err)
+	}
+	if !reflect.DeepEqual(state, written) {
+		t.Errorf("expected %+v, got %+v", written, state)
+	}
+
+	if err := os.WriteFile(stateFile, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadState(stateFile); err == nil {
+		t.Error("expected error for invalid state file")
+	}
+}
+
+func TestPoll(t *testing.T) {
+	versions := []concourse.Version{
+		{Id: "1", LastUpdated: "2025-01-01T00:00:00Z", ObjectType: "devices", DeviceName: "server-1"},
+		{Id: "2", LastUpdated: "2025-01-02T00:00:00Z", ObjectType: "devices", DeviceName: "server-2"},
+	}
+
+	tests := []struct {
+		name     string
+		command  []string
+		queryErr error
+		handled  int
+		state    string
+		lines    int
+		wantErr  bool
+	}{
+		{"jsonLines", nil, nil, 2, "2", 2, false},
+		{"command", []string{"sh", "-c", `grep -q "\"id\":\"$NETBOX_ID\"" && echo $NETBOX_DEVICE_NAME`}, nil, 2, "2", 2, false},
+		{"commandFails", []string{"sh", "-c", "test $NETBOX_ID = 1"}, nil, 1, "1", 0, true},
+		{"queryFails", nil, fmt.Errorf("unavailable"), 0, "0", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				stdout bytes.Buffer
+				input  concourse.Input
+			)
+
+			config := Config{Source: concourse.Source{Url: "https://netbox.example.local"}, StateFile: filepath.Join(t.TempDir(), "state.json"), Command: test.command}
+			previous := concourse.Version{Id: "0", LastUpdated: "2024-12-31T00:00:00Z", ObjectType: "devices"}
+			if err := WriteState(config.StateFile, State{Version: previous, Seen: []string{"devices/0"}}); err != nil {
+				t.Fatal(err)
+			}
+			query := func(queryInput concourse.Input, ctx context.Context) ([]concourse.Version, error) {
+				input = queryInput
+				return versions, test.queryErr
+			}
+
+			handled, err := Poll(config, query, &stdout, context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Poll() error: '%v', error expected: %v", err, test.wantErr)
+			}
+			if input.Version.Id != previous.Id || input.Version.LastUpdated != "2024-12-30T23:59:59Z" || input.Source.Url != config.Source.Url {
+				t.Errorf("expected query with source and last seen version a second earlier, got %+v", input)
+			}
+			if handled != test.handled {
+				t.Errorf("expected %d handled versions, got %d", test.handled, handled)
+			}
+			state, err := ReadState(config.StateFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Version.Id != test.state {
+				t.Errorf("expected state %q, got %+v", test.state, state)
+			}
+
+			lines := strings.Fields(stdout.String())
+			if len(lines) != test.lines {
+				t.Fatalf("expected %d output lines, got %q", test.lines, stdout.String())
+			}
+			if test.command == nil && test.lines > 0 {
+				var version concourse.Version
+				if err := json.Unmarshal([]byte(lines[0]), &version); err != nil || version != versions[0] {
+					t.Errorf("expected JSON line of %+v, got %s", versions[0], lines[0])
+				}
+			}
+		})
+	}
+}
+
+func TestPollSkipsHandledVersions(t *testing.T) {
+	device := concourse.Version{Id: "1", LastUpdated: "2025-01-01T00:00:00Z", ObjectType: "devices"}
+	interfaces := []concourse.Version{
+		{Id: "10", LastUpdated: "2025-01-02T00:00:00Z", ObjectType: "interfaces"},
+		{Id: "11", LastUpdated: "2025-01-02T00:00:00Z", ObjectType: "interfaces"},
+		{Id: "12", LastUpdated: "2025-01-02T00:00:00Z", ObjectType: "interfaces"},
+	}
+
+	tests := []struct {
+		name     string
+		state    State
+		versions []concourse.Version
+		command  []string
+		expected []string
+		seen     []string
+		wantErr  bool
+	}{
+		{"savedVersionReturnedAgain", State{Version: device, Seen: []string{"devices/1"}}, []concourse.Version{device}, nil, []string{}, []string{"devices/1"}, false},
+		{"olderVersionReturned", State{Version: interfaces[0], Seen: []string{"interfaces/10"}}, []concourse.Version{device, interfaces[0]}, nil, []string{}, []string{"interfaces/10"}, false},
+		{"remainingInterfacesOfTimestamp", State{Version: interfaces[0], Seen: []string{"interfaces/10"}}, interfaces, nil, []string{"11", "12"}, []string{"interfaces/10", "interfaces/11", "interfaces/12"}, false},
+		{"failurePartwayThroughTimestamp", State{Version: device, Seen: []string{"devices/1"}}, interfaces, []string{"sh", "-c", "test $NETBOX_ID != 11 && echo $NETBOX_ID"}, []string{"10"}, []string{"interfaces/10"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				stdout bytes.Buffer
+			)
+
+			config := Config{StateFile: filepath.Join(t.TempDir(), "state.json"), Command: test.command}
+			if err := WriteState(config.StateFile, test.state); err != nil {
+				t.Fatal(err)
+			}
+			query := func(input concourse.Input, ctx context.Context) ([]concourse.Version, error) {
+				return test.versions, nil
+			}
+
+			_, err := Poll(config, query, &stdout, context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Poll() error: '%v', error expected: %v", err, test.wantErr)
+			}
+
+			handled := []string{}
+			for _, line := range strings.Fields(stdout.String()) {
+				var version concourse.Version
+				if err := json.Unmarshal([]byte(line), &version); err != nil {
+					version.Id = line
+				}
+				handled = append(handled, version.Id)
+			}
+			if !reflect.DeepEqual(handled, test.expected) {
+				t.Errorf("expected handled versions %v, got %v", test.expected, handled)
+			}
+			state, err := ReadState(config.StateFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(state.Seen, test.seen) {
+				t.Errorf("expected seen %v, got %v", test.seen, state.Seen)
+			}
+		})
+	}
+}
@@ -50,6 +50,12 @@ func main() {
 	case "out":
 		cmdlineHelp(cmdlineflags, app.UsageOut)
 		app.Out()
+	case "relay":
+		cmdlineHelp(cmdlineflags, app.UsageRelay)
+		app.Relay()
+	case "watch":
+		cmdlineHelp(cmdlineflags, app.UsageWatch)
+		app.Watch()
 	default:
 		fmt.Fprintf(os.Stderr, "unknown executable name: %s\n", executableName)
 		os.Exit(1)